@@ -0,0 +1,487 @@
+// Package boltqueue implements a shuffled priority queue stored in a bbolt database file.
+//
+// Values are stored as JSON and returned the way encoding/json decodes them into an interface{},
+// so numbers come back as float64. The database holds three buckets:
+//
+//	priorities/<priority>/slots/<index>  value     the values of a priority in a dense array
+//	priorities/<priority>/index/<value>  index     the slot of every value of a priority
+//	priorities/<priority>/n              count     the number of values of a priority
+//	values/<value>/<priority>                      the priorities of every value, in ascending order
+//	meta/length                          length    the number of values in the queue
+//
+// Priorities are encoded so that they sort in ascending order. Keeping the values of a priority in a dense array
+// lets the queue pick one at random without reading the others. Every call runs in its own transaction.
+package boltqueue
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	spq "github.com/theodesp/go-shuffled-queue"
+)
+
+var (
+	prioritiesBucket = []byte("priorities")
+	valuesBucket     = []byte("values")
+	metaBucket       = []byte("meta")
+	slotsBucket      = []byte("slots")
+	indexBucket      = []byte("index")
+	countKey         = []byte("n")
+	lengthKey        = []byte("length")
+)
+
+// Returned when a value is too large to be stored.
+var ErrTooLarge = errors.New("boltqueue: value too large")
+
+// A Queue is a shuffled priority queue stored in a bbolt database. It may be used from many goroutines
+// and picks values with the same priority uniformly at random.
+type Queue struct {
+	db *bolt.DB
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+var _ spq.Queue = (*Queue)(nil)
+
+// Opens the queue stored in the database file at path, creating it with the specified mode if needed.
+// Waits up to a second for other processes to close the file.
+func Open(path string, mode os.FileMode) (*Queue, error) {
+	db, err := bolt.Open(path, mode, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{prioritiesBucket, valuesBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	q := Queue{
+		db:   db,
+		rand: rand.New(rand.NewSource(time.Now().UTC().UnixNano()))}
+
+	return &q, nil
+}
+
+// Closes the database file.
+func (q *Queue) Close() error {
+	return q.db.Close()
+}
+
+// Sets the source of the random picks among values with the same priority.
+func (q *Queue) SetRandSource(src rand.Source) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.rand = rand.New(src)
+}
+
+// Adds a value to the queue using the default priority.
+// Returns the value added.
+func (q *Queue) Add(v interface{}) interface{} {
+	return q.AddPriority(v, spq.DefaultPriority)
+}
+
+// Adds a value to the queue using a specified priority.
+// Returns the value added. Values that cannot be added are dropped, see TryAddPriority.
+func (q *Queue) AddPriority(v interface{}, priority int) interface{} {
+	q.TryAddPriority(v, priority)
+	return v
+}
+
+// Removes the value from the queue if exists.
+// Returns true if the value was removed or false if the value was not found.
+func (q *Queue) Remove(v interface{}) bool {
+	return q.TryRemove(v) == nil
+}
+
+// Returns the lowest priority of the value.
+// Returns true if found otherwise false.
+func (q *Queue) FindPriority(v interface{}) (int, bool) {
+	priority, err := q.TryFindPriority(v)
+
+	if err != nil {
+		return -1, false
+	}
+
+	return priority, true
+}
+
+// Removes and returns the highest priority value from the queue.
+// Returns true if found otherwise false.
+func (q *Queue) Pop() (interface{}, bool) {
+	v, err := q.TryPop()
+	return v, err == nil
+}
+
+// Removes and returns the lowest priority value from the queue.
+// Returns true if found otherwise false.
+func (q *Queue) Shift() (interface{}, bool) {
+	v, err := q.TryShift()
+	return v, err == nil
+}
+
+// Returns the lowest priority value from the queue without removing it.
+// Returns true if found otherwise false.
+func (q *Queue) First() (interface{}, bool) {
+	v, err := q.TryFirst()
+	return v, err == nil
+}
+
+// Returns the highest priority value from the queue without removing it.
+// Returns true if found otherwise false.
+func (q *Queue) Last() (interface{}, bool) {
+	v, err := q.TryLast()
+	return v, err == nil
+}
+
+// Adds a value to the queue using a specified priority. Adding a value that already exists with the same
+// priority does nothing. Returns spq.ErrUnhashable if the value cannot be encoded as JSON, ErrTooLarge if it
+// is too large or the error of the database.
+func (q *Queue) TryAddPriority(v interface{}, priority int) error {
+	value, err := encodeValue(v)
+	if err != nil {
+		return err
+	}
+
+	return q.db.Update(func(tx *bolt.Tx) error {
+		return add(tx, value, priority)
+	})
+}
+
+// Removes the lowest priority occurrence of the value from the queue.
+// Returns spq.ErrNotFound if the value is not in the queue.
+func (q *Queue) TryRemove(v interface{}) error {
+	value, err := encodeValue(v)
+	if err != nil {
+		return err
+	}
+
+	return q.db.Update(func(tx *bolt.Tx) error {
+		priority, err := findPriority(tx, value)
+		if err != nil {
+			return err
+		}
+
+		return remove(tx, value, priority)
+	})
+}
+
+// Returns the lowest priority of the value.
+// Returns spq.ErrNotFound if the value is not in the queue.
+func (q *Queue) TryFindPriority(v interface{}) (int, error) {
+	value, err := encodeValue(v)
+	if err != nil {
+		return 0, err
+	}
+
+	var priority int
+	err = q.db.View(func(tx *bolt.Tx) error {
+		priority, err = findPriority(tx, value)
+		return err
+	})
+
+	return priority, err
+}
+
+// Removes and returns the highest priority value from the queue.
+// Returns spq.ErrEmpty if the queue is empty.
+func (q *Queue) TryPop() (interface{}, error) {
+	return q.take(true)
+}
+
+// Removes and returns the lowest priority value from the queue.
+// Returns spq.ErrEmpty if the queue is empty.
+func (q *Queue) TryShift() (interface{}, error) {
+	return q.take(false)
+}
+
+// Returns the lowest priority value from the queue without removing it.
+// Returns spq.ErrEmpty if the queue is empty.
+func (q *Queue) TryFirst() (interface{}, error) {
+	return q.peek(false)
+}
+
+// Returns the highest priority value from the queue without removing it.
+// Returns spq.ErrEmpty if the queue is empty.
+func (q *Queue) TryLast() (interface{}, error) {
+	return q.peek(true)
+}
+
+// Returns the number of values in the queue.
+func (q *Queue) Len() (int, error) {
+	var length uint64
+
+	err := q.db.View(func(tx *bolt.Tx) error {
+		length = getUint(tx.Bucket(metaBucket), lengthKey)
+		return nil
+	})
+
+	return int(length), err
+}
+
+// Removes a value picked at random among the highest or the lowest priority values, in a single transaction.
+func (q *Queue) take(highest bool) (interface{}, error) {
+	var value []byte
+
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		priority, pb := edgePriority(tx, highest)
+		if pb == nil {
+			return spq.ErrEmpty
+		}
+
+		value = q.pick(pb)
+		return remove(tx, value, priority)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeValue(value)
+}
+
+// Returns a value picked at random among the highest or the lowest priority values.
+func (q *Queue) peek(highest bool) (interface{}, error) {
+	var value []byte
+
+	err := q.db.View(func(tx *bolt.Tx) error {
+		_, pb := edgePriority(tx, highest)
+		if pb == nil {
+			return spq.ErrEmpty
+		}
+
+		value = q.pick(pb)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeValue(value)
+}
+
+// Returns a copy of a value of the priority bucket picked uniformly at random.
+func (q *Queue) pick(pb *bolt.Bucket) []byte {
+	q.mu.Lock()
+	i := q.rand.Int63n(int64(getUint(pb, countKey)))
+	q.mu.Unlock()
+
+	return clone(pb.Bucket(slotsBucket).Get(encodeUint(uint64(i))))
+}
+
+// Returns the highest or the lowest priority and its bucket, or a nil bucket if the queue is empty.
+func edgePriority(tx *bolt.Tx, highest bool) (int, *bolt.Bucket) {
+	c := tx.Bucket(prioritiesBucket).Cursor()
+
+	k, _ := c.First()
+	if highest {
+		k, _ = c.Last()
+	}
+
+	if k == nil {
+		return 0, nil
+	}
+
+	return decodePriority(k), tx.Bucket(prioritiesBucket).Bucket(k)
+}
+
+// Returns the lowest priority of a value.
+func findPriority(tx *bolt.Tx, value []byte) (int, error) {
+	vb := tx.Bucket(valuesBucket).Bucket(value)
+	if vb == nil {
+		return 0, spq.ErrNotFound
+	}
+
+	k, _ := vb.Cursor().First()
+	if k == nil {
+		return 0, spq.ErrNotFound
+	}
+
+	return decodePriority(k), nil
+}
+
+// Appends a value to the slots of its priority unless it is already there.
+func add(tx *bolt.Tx, value []byte, priority int) error {
+	pb, err := tx.Bucket(prioritiesBucket).CreateBucketIfNotExists(encodePriority(priority))
+	if err != nil {
+		return err
+	}
+
+	slots, err := pb.CreateBucketIfNotExists(slotsBucket)
+	if err != nil {
+		return err
+	}
+
+	index, err := pb.CreateBucketIfNotExists(indexBucket)
+	if err != nil {
+		return err
+	}
+
+	if index.Get(value) != nil {
+		return nil
+	}
+
+	n := getUint(pb, countKey)
+	if err := slots.Put(encodeUint(n), value); err != nil {
+		return err
+	}
+
+	if err := index.Put(value, encodeUint(n)); err != nil {
+		return err
+	}
+
+	if err := pb.Put(countKey, encodeUint(n+1)); err != nil {
+		return err
+	}
+
+	vb, err := tx.Bucket(valuesBucket).CreateBucketIfNotExists(value)
+	if err != nil {
+		return err
+	}
+
+	if err := vb.Put(encodePriority(priority), []byte{}); err != nil {
+		return err
+	}
+
+	meta := tx.Bucket(metaBucket)
+	return meta.Put(lengthKey, encodeUint(getUint(meta, lengthKey)+1))
+}
+
+// Removes a value from the slots of its priority by moving the last slot in its place.
+// Drops the buckets left empty.
+func remove(tx *bolt.Tx, value []byte, priority int) error {
+	key := encodePriority(priority)
+	priorities := tx.Bucket(prioritiesBucket)
+
+	pb := priorities.Bucket(key)
+	if pb == nil {
+		return spq.ErrNotFound
+	}
+
+	slots, index := pb.Bucket(slotsBucket), pb.Bucket(indexBucket)
+
+	slot := clone(index.Get(value))
+	if slot == nil {
+		return spq.ErrNotFound
+	}
+
+	last := getUint(pb, countKey) - 1
+
+	if last == 0 {
+		if err := priorities.DeleteBucket(key); err != nil {
+			return err
+		}
+	} else {
+		if i := binary.BigEndian.Uint64(slot); i != last {
+			moved := clone(slots.Get(encodeUint(last)))
+
+			if err := slots.Put(slot, moved); err != nil {
+				return err
+			}
+
+			if err := index.Put(moved, slot); err != nil {
+				return err
+			}
+		}
+
+		if err := slots.Delete(encodeUint(last)); err != nil {
+			return err
+		}
+
+		if err := index.Delete(value); err != nil {
+			return err
+		}
+
+		if err := pb.Put(countKey, encodeUint(last)); err != nil {
+			return err
+		}
+	}
+
+	values := tx.Bucket(valuesBucket)
+	vb := values.Bucket(value)
+
+	if err := vb.Delete(key); err != nil {
+		return err
+	}
+
+	if k, _ := vb.Cursor().First(); k == nil {
+		if err := values.DeleteBucket(value); err != nil {
+			return err
+		}
+	}
+
+	meta := tx.Bucket(metaBucket)
+	return meta.Put(lengthKey, encodeUint(getUint(meta, lengthKey)-1))
+}
+
+func encodeValue(v interface{}) ([]byte, error) {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return nil, spq.ErrUnhashable
+	}
+
+	if len(value) > bolt.MaxKeySize {
+		return nil, ErrTooLarge
+	}
+
+	return value, nil
+}
+
+func decodeValue(value []byte) (interface{}, error) {
+	var v interface{}
+	err := json.Unmarshal(value, &v)
+	return v, err
+}
+
+// Encodes a priority so that encoded priorities sort like the priorities.
+func encodePriority(priority int) []byte {
+	return encodeUint(uint64(priority) ^ 1<<63)
+}
+
+func decodePriority(key []byte) int {
+	return int(binary.BigEndian.Uint64(key) ^ 1<<63)
+}
+
+func encodeUint(i uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, i)
+	return b
+}
+
+// Returns the integer stored under the key, 0 if there is none.
+func getUint(b *bolt.Bucket, key []byte) uint64 {
+	v := b.Get(key)
+	if v == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint64(v)
+}
+
+// Copies a slice read from the database, which is only valid until the transaction changes the database.
+func clone(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+
+	return append([]byte{}, b...)
+}
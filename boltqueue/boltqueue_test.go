@@ -0,0 +1,144 @@
+package boltqueue
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	spq "github.com/theodesp/go-shuffled-queue"
+	"github.com/theodesp/go-shuffled-queue/queuetest"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type BoltSuite struct {
+	dir string
+}
+
+var _ = Suite(&BoltSuite{})
+
+func (s *BoltSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+}
+
+func (s *BoltSuite) open(c *C, name string) *Queue {
+	q, err := Open(filepath.Join(s.dir, name), 0600)
+	c.Assert(err, IsNil)
+
+	return q
+}
+
+// Test the queue conforms to the behaviour of the in process queue.
+func (s *BoltSuite) TestConformance(c *C) {
+	queues := []*Queue{}
+	defer func() {
+		for _, q := range queues {
+			q.Close()
+		}
+	}()
+
+	c.Assert(queuetest.Check(func() spq.Queue {
+		q := s.open(c, "queue"+string(rune('a'+len(queues)))+".db")
+		q.SetRandSource(rand.NewSource(1))
+		queues = append(queues, q)
+		return q
+	}), IsNil)
+}
+
+// Test the values are kept when the database is reopened.
+func (s *BoltSuite) TestReopen(c *C) {
+	q := s.open(c, "queue.db")
+	q.AddPriority("hello", 1)
+	q.AddPriority(map[string]interface{}{"id": 7}, 5)
+	q.AddPriority("world", -1)
+	q.Pop()
+	c.Assert(q.Close(), IsNil)
+
+	q = s.open(c, "queue.db")
+	defer q.Close()
+
+	length, err := q.Len()
+	c.Assert(err, IsNil)
+	c.Assert(length, Equals, 2)
+
+	v, _ := q.Pop()
+	c.Assert(v, Equals, "hello")
+	v, _ = q.Pop()
+	c.Assert(v, Equals, "world")
+}
+
+// Test the slots of a priority stay dense as values are removed from anywhere.
+func (s *BoltSuite) TestRemoveFromSlots(c *C) {
+	q := s.open(c, "queue.db")
+	defer q.Close()
+
+	model := spq.NewSPQ()
+	r := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 500; i += 1 {
+		v, priority := float64(r.Intn(50)), r.Intn(3)
+
+		switch r.Intn(3) {
+		case 0, 1:
+			q.AddPriority(v, priority)
+			model.AddPriority(v, priority)
+		case 2:
+			c.Assert(q.Remove(v), Equals, model.Remove(v))
+		}
+	}
+
+	length, _ := q.Len()
+	c.Assert(length, Equals, model.Len())
+
+	for i := 0; i < 50; i += 1 {
+		v := float64(i)
+
+		for {
+			p, ok := q.FindPriority(v)
+			mp, mok := model.FindPriority(v)
+			c.Assert(p, Equals, mp)
+			c.Assert(ok, Equals, mok)
+
+			if !ok {
+				break
+			}
+
+			c.Assert(q.Remove(v), Equals, model.Remove(v))
+		}
+	}
+
+	_, err := q.TryPop()
+	c.Assert(err, Equals, spq.ErrEmpty)
+}
+
+// Test the errors of the queue.
+func (s *BoltSuite) TestErrors(c *C) {
+	q := s.open(c, "queue.db")
+	defer q.Close()
+
+	_, err := q.TryPop()
+	c.Assert(err, Equals, spq.ErrEmpty)
+	_, err = q.TryFirst()
+	c.Assert(err, Equals, spq.ErrEmpty)
+	c.Assert(q.TryRemove("hello"), Equals, spq.ErrNotFound)
+	c.Assert(q.TryAddPriority(func() {}, 1), Equals, spq.ErrUnhashable)
+	c.Assert(q.TryAddPriority(string(make([]byte, 40000)), 1), Equals, ErrTooLarge)
+}
+
+// Test a database file held by another queue cannot be opened.
+func (s *BoltSuite) TestLocked(c *C) {
+	q := s.open(c, "queue.db")
+	defer q.Close()
+
+	_, err := Open(filepath.Join(s.dir, "queue.db"), 0600)
+	c.Assert(err, NotNil)
+
+	_, err = Open(filepath.Join(s.dir, "missing", "queue.db"), 0600)
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
@@ -0,0 +1,329 @@
+package go_shuffled_queue
+
+import (
+	"sync/atomic"
+
+	"deckarep/golang-set"
+)
+
+// Buckets with fewer holes than this are never compacted.
+const minCompaction = 32
+
+// A bucket holds all the items sharing the same priority.
+// On top of the set it remembers insertion order so tie breakers can rely on it: items are kept in slots
+// in the order they were added, removed items leaving a hole, and a Fenwick tree over the number of
+// occurrences of every slot finds the slot of an occurrence in logarithmic time.
+// In multiset mode items may occur more than once, counts holds the items occurring more than once
+// and size the total number of occurrences. Handles counts the items added with Push.
+// Buckets may be shared between snapshots of a queue, refs counts how many queues hold it.
+type bucket struct {
+	mapset.Set
+	slots    []interface{}
+	weights  []int
+	tree     []int
+	index    map[interface{}]int
+	holes    int
+	payloads map[interface{}]interface{}
+	meta     map[interface{}]metadata
+	counts   map[interface{}]int
+	size     int
+	handles  int
+	refs     int32
+
+	// The payload of an occurrence given to tie breakers, built once so that picks do not allocate.
+	valueAt func(i int) interface{}
+}
+
+// Stands for an item added with AddKeyed in the bucket set, its payload is kept aside.
+type keyRef struct {
+	key interface{}
+}
+
+// Creates and returns a reference to an empty bucket.
+func newBucket() *bucket {
+	b := bucket{
+		Set:      mapset.NewSet(),
+		index:    make(map[interface{}]int),
+		payloads: make(map[interface{}]interface{}),
+		meta:     make(map[interface{}]metadata),
+		counts:   make(map[interface{}]int),
+		refs:     1}
+
+	b.valueAt = func(i int) interface{} {
+		return b.value(b.at(i))
+	}
+
+	return &b
+}
+
+// Returns a deep copy of the bucket that is not shared with any queue.
+func (b *bucket) clone() *bucket {
+	nb := newBucket()
+
+	for _, v := range b.items() {
+		nb.put(v, b.value(v))
+		nb.meta[v] = b.meta[v]
+
+		for i := b.count(v); i > 1; i -= 1 {
+			nb.increment(v)
+		}
+	}
+
+	return nb
+}
+
+// Returns true if the bucket is held by more than one queue.
+func (b *bucket) shared() bool {
+	return atomic.LoadInt32(&b.refs) > 1
+}
+
+// Marks the bucket as held by one more queue.
+func (b *bucket) share() {
+	atomic.AddInt32(&b.refs, 1)
+}
+
+// Marks the bucket as no longer held by one of its queues.
+func (b *bucket) release() {
+	atomic.AddInt32(&b.refs, -1)
+}
+
+// Adds an item to the bucket.
+// Returns true if the item was not already in the bucket.
+func (b *bucket) Add(v interface{}) bool {
+	if !b.Set.Add(v) {
+		return false
+	}
+
+	b.index[v] = len(b.slots)
+	b.slots = append(b.slots, v)
+	b.weights = append(b.weights, 1)
+	b.appendTree(1)
+	b.size += 1
+
+	if _, ok := v.(*Handle); ok {
+		b.handles += 1
+	}
+
+	return true
+}
+
+// Adds an item to the bucket along with its payload, which is only kept for keyed items.
+// Replaces the payload of a keyed item already in the bucket.
+func (b *bucket) put(v interface{}, payload interface{}) {
+	if ref, ok := v.(keyRef); ok {
+		b.payloads[ref.key] = payload
+	}
+
+	b.Add(v)
+}
+
+// Removes an item from the bucket if it exists.
+func (b *bucket) Remove(v interface{}) {
+	slot, ok := b.index[v]
+
+	if !ok {
+		return
+	}
+
+	b.size -= b.count(v)
+	b.Set.Remove(v)
+	b.addTree(slot, -b.weights[slot])
+	b.slots[slot] = nil
+	b.weights[slot] = 0
+	b.holes += 1
+	delete(b.index, v)
+	delete(b.counts, v)
+	delete(b.meta, v)
+
+	if ref, ok := v.(keyRef); ok {
+		delete(b.payloads, ref.key)
+	}
+
+	if _, ok := v.(*Handle); ok {
+		b.handles -= 1
+	}
+
+	if b.holes >= minCompaction && b.holes > len(b.slots)/2 {
+		b.compact()
+	}
+}
+
+// Returns how many times the item occurs in the bucket.
+func (b *bucket) count(v interface{}) int {
+	if !b.Contains(v) {
+		return 0
+	}
+
+	if count, ok := b.counts[v]; ok {
+		return count
+	}
+
+	return 1
+}
+
+// Adds one more occurrence of an item already in the bucket.
+func (b *bucket) increment(v interface{}) {
+	b.counts[v] = b.count(v) + 1
+	b.size += 1
+
+	slot := b.index[v]
+	b.weights[slot] += 1
+	b.addTree(slot, 1)
+}
+
+// Removes one occurrence of the item, removing the item once none is left.
+func (b *bucket) decrement(v interface{}) {
+	count := b.count(v)
+
+	if count <= 1 {
+		b.Remove(v)
+		return
+	}
+
+	if count == 2 {
+		delete(b.counts, v)
+	} else {
+		b.counts[v] = count - 1
+	}
+	b.size -= 1
+
+	slot := b.index[v]
+	b.weights[slot] -= 1
+	b.addTree(slot, -1)
+}
+
+// Returns the item of the occurrence at index i, counting occurrences in insertion order.
+func (b *bucket) at(i int) interface{} {
+	slot := 0
+
+	for step := highestBit(len(b.tree)); step > 0; step >>= 1 {
+		if next := slot + step; next <= len(b.tree) && b.tree[next-1] <= i {
+			slot = next
+			i -= b.tree[next-1]
+		}
+	}
+
+	return b.slots[slot]
+}
+
+// Returns the index of the first occurrence of an item of the bucket.
+func (b *bucket) rank(v interface{}) int {
+	i := 0
+	for slot := b.index[v]; slot > 0; slot -= slot & -slot {
+		i += b.tree[slot-1]
+	}
+
+	return i
+}
+
+// Adds delta to the weight of a slot in the Fenwick tree.
+func (b *bucket) addTree(slot int, delta int) {
+	for i := slot + 1; i <= len(b.tree); i += i & -i {
+		b.tree[i-1] += delta
+	}
+}
+
+// Appends the weight of a new slot to the Fenwick tree.
+func (b *bucket) appendTree(weight int) {
+	n := len(b.tree) + 1
+	for i := n - 1; i > n-(n&-n); i -= i & -i {
+		weight += b.tree[i-1]
+	}
+
+	b.tree = append(b.tree, weight)
+}
+
+// Drops the holes left by removed items and rebuilds the Fenwick tree.
+func (b *bucket) compact() {
+	slots := make([]interface{}, 0, len(b.index))
+	weights := make([]int, 0, len(b.index))
+
+	for slot, v := range b.slots {
+		if b.weights[slot] > 0 {
+			b.index[v] = len(slots)
+			slots = append(slots, v)
+			weights = append(weights, b.weights[slot])
+		}
+	}
+
+	b.slots, b.weights, b.holes = slots, weights, 0
+	b.tree = append([]int{}, weights...)
+
+	for i := 1; i <= len(b.tree); i += 1 {
+		if parent := i + i&-i; parent <= len(b.tree) {
+			b.tree[parent-1] += b.tree[i-1]
+		}
+	}
+}
+
+// Returns the highest power of two not above n, or 0.
+func highestBit(n int) int {
+	bit := 0
+	for n > 0 {
+		bit = n
+		n &= n - 1
+	}
+
+	return bit
+}
+
+// Returns the bucket items in insertion order with each item repeated as many times as it occurs.
+func (b *bucket) occurrences() []interface{} {
+	if len(b.counts) == 0 {
+		return b.items()
+	}
+
+	occurrences := make([]interface{}, 0, b.size)
+
+	for slot, v := range b.slots {
+		for i := b.weights[slot]; i > 0; i -= 1 {
+			occurrences = append(occurrences, v)
+		}
+	}
+
+	return occurrences
+}
+
+// Returns the key and the payload of an item of the bucket.
+// Items added with Push have their handle as key, other items that were not added with a key
+// are their own key and payload.
+func (b *bucket) entry(v interface{}) (interface{}, interface{}) {
+	switch item := v.(type) {
+	case keyRef:
+		return item.key, b.payloads[item.key]
+	case *Handle:
+		return item, item.value
+	}
+
+	return v, v
+}
+
+// Returns the payload of an item of the bucket.
+func (b *bucket) value(v interface{}) interface{} {
+	_, payload := b.entry(v)
+	return payload
+}
+
+// Returns the payloads of the bucket items in insertion order with each item repeated as many times as it occurs.
+func (b *bucket) values() []interface{} {
+	values := b.occurrences()
+
+	for i, v := range values {
+		values[i] = b.value(v)
+	}
+
+	return values
+}
+
+// Returns the bucket items in insertion order.
+func (b *bucket) items() []interface{} {
+	items := make([]interface{}, 0, len(b.index))
+
+	for slot, v := range b.slots {
+		if b.weights[slot] > 0 {
+			items = append(items, v)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,330 @@
+// Package client talks to the queues hosted by spqd over HTTP.
+// Values are sent as JSON and received the way encoding/json decodes them into an interface{},
+// so numbers come back as float64.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	spq "github.com/theodesp/go-shuffled-queue"
+)
+
+// How long a call may take unless told otherwise, not counting how long a blocking pop waits.
+const DefaultTimeout = 10 * time.Second
+
+// How many times calls that can safely be repeated are retried unless told otherwise.
+const DefaultRetries = 2
+
+// A Client uses one named queue of a server. It implements spq.Queue, the methods of the interface
+// report failures as not found. The methods taking a context return the errors, the errors of the queue
+// are the ones of spq such as spq.ErrEmpty. A client may be used from many goroutines.
+type Client struct {
+	// The HTTP client sending the requests, its transport pools the connections.
+	HTTPClient *http.Client
+	// How long a call may take when its context has no deadline, not counting how long a blocking pop waits.
+	Timeout time.Duration
+	// How many times reading calls are retried after a network error or an unavailable server.
+	Retries int
+	// How long to wait before the first retry, doubled for every further retry.
+	Backoff time.Duration
+
+	url string
+}
+
+var _ spq.Queue = (*Client)(nil)
+
+// An item as sent and received over HTTP.
+type itemJSON struct {
+	Value    interface{} `json:"value"`
+	Priority int         `json:"priority"`
+}
+
+type statsJSON struct {
+	Length int `json:"length"`
+}
+
+type errorJSON struct {
+	Error string `json:"error"`
+}
+
+// The errors of the queue recognised in the replies of the server.
+var queueErrors = []error{
+	spq.ErrEmpty, spq.ErrNotFound, spq.ErrUnhashable, spq.ErrClosed, spq.ErrFull, spq.ErrRateLimited}
+
+// Creates and returns a reference to a client of the queue with the specified name
+// hosted by the server at baseURL, such as http://localhost:7070.
+func NewClient(baseURL, name string) *Client {
+	c := Client{
+		HTTPClient: &http.Client{Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 100,
+			IdleConnTimeout:     90 * time.Second}},
+		Timeout: DefaultTimeout,
+		Retries: DefaultRetries,
+		Backoff: 50 * time.Millisecond,
+		url:     strings.TrimSuffix(baseURL, "/") + "/queues/" + url.PathEscape(name)}
+
+	return &c
+}
+
+// Adds a value to the queue using the default priority.
+// Returns the value added.
+func (c *Client) Add(v interface{}) interface{} {
+	return c.AddPriority(v, spq.DefaultPriority)
+}
+
+// Adds a value to the queue using a specified priority.
+// Returns the value added. Values that cannot be added are dropped, see AddPriorityContext.
+func (c *Client) AddPriority(v interface{}, priority int) interface{} {
+	c.AddPriorityContext(context.Background(), v, priority)
+	return v
+}
+
+// Removes the value from the queue if exists.
+// Returns true if the value was removed or false if the value was not found.
+func (c *Client) Remove(v interface{}) bool {
+	return c.RemoveContext(context.Background(), v) == nil
+}
+
+// Returns the lowest priority of the value.
+// Returns true if found otherwise false.
+func (c *Client) FindPriority(v interface{}) (int, bool) {
+	priority, err := c.FindPriorityContext(context.Background(), v)
+
+	if err != nil {
+		return -1, false
+	}
+
+	return priority, true
+}
+
+// Removes and returns the highest priority value from the queue.
+// Returns true if found otherwise false.
+func (c *Client) Pop() (interface{}, bool) {
+	v, _, err := c.PopContext(context.Background())
+	return v, err == nil
+}
+
+// Removes and returns the lowest priority value from the queue.
+// Returns true if found otherwise false.
+func (c *Client) Shift() (interface{}, bool) {
+	v, _, err := c.ShiftContext(context.Background())
+	return v, err == nil
+}
+
+// Returns the lowest priority value from the queue without removing it.
+// Returns true if found otherwise false.
+func (c *Client) First() (interface{}, bool) {
+	v, err := c.FirstContext(context.Background())
+	return v, err == nil
+}
+
+// Returns the highest priority value from the queue without removing it.
+// Returns true if found otherwise false.
+func (c *Client) Last() (interface{}, bool) {
+	v, err := c.LastContext(context.Background())
+	return v, err == nil
+}
+
+// Adds a value to the queue using a specified priority.
+func (c *Client) AddPriorityContext(ctx context.Context, v interface{}, priority int) error {
+	body, err := json.Marshal(itemJSON{Value: v, Priority: priority})
+	if err != nil {
+		return err
+	}
+
+	return c.call(ctx, http.MethodPost, "/items", nil, body, 0, nil)
+}
+
+// Removes the value from the queue. Returns spq.ErrNotFound if the value is not in the queue.
+func (c *Client) RemoveContext(ctx context.Context, v interface{}) error {
+	query, err := valueQuery(v)
+	if err != nil {
+		return err
+	}
+
+	return c.call(ctx, http.MethodDelete, "/items", query, nil, 0, nil)
+}
+
+// Returns the lowest priority of the value. Returns spq.ErrNotFound if the value is not in the queue.
+func (c *Client) FindPriorityContext(ctx context.Context, v interface{}) (int, error) {
+	query, err := valueQuery(v)
+	if err != nil {
+		return 0, err
+	}
+
+	var item itemJSON
+	err = c.call(ctx, http.MethodGet, "/priority", query, nil, 0, &item)
+	return item.Priority, err
+}
+
+// Removes and returns the highest priority value from the queue along with its priority.
+// Returns spq.ErrEmpty if the queue is empty or spq.ErrRateLimited if rate limits hold back every value.
+func (c *Client) PopContext(ctx context.Context) (interface{}, int, error) {
+	return c.take(ctx, "/pop", 0)
+}
+
+// Removes and returns the lowest priority value from the queue along with its priority.
+// Returns spq.ErrEmpty if the queue is empty or spq.ErrRateLimited if rate limits hold back every value.
+func (c *Client) ShiftContext(ctx context.Context) (interface{}, int, error) {
+	return c.take(ctx, "/shift", 0)
+}
+
+// Like PopContext but waits up to wait for a value when the queue is empty.
+// The server may wait less than asked.
+func (c *Client) BlockingPop(ctx context.Context, wait time.Duration) (interface{}, int, error) {
+	return c.take(ctx, "/pop", wait)
+}
+
+// Like ShiftContext but waits up to wait for a value when the queue is empty.
+// The server may wait less than asked.
+func (c *Client) BlockingShift(ctx context.Context, wait time.Duration) (interface{}, int, error) {
+	return c.take(ctx, "/shift", wait)
+}
+
+// Returns the lowest priority value from the queue without removing it.
+// Returns spq.ErrEmpty if the queue is empty.
+func (c *Client) FirstContext(ctx context.Context) (interface{}, error) {
+	var item itemJSON
+	err := c.call(ctx, http.MethodGet, "/first", nil, nil, 0, &item)
+	return item.Value, err
+}
+
+// Returns the highest priority value from the queue without removing it.
+// Returns spq.ErrEmpty if the queue is empty.
+func (c *Client) LastContext(ctx context.Context) (interface{}, error) {
+	var item itemJSON
+	err := c.call(ctx, http.MethodGet, "/last", nil, nil, 0, &item)
+	return item.Value, err
+}
+
+// Returns the number of values in the queue.
+func (c *Client) LenContext(ctx context.Context) (int, error) {
+	var stats statsJSON
+	err := c.call(ctx, http.MethodGet, "/stats", nil, nil, 0, &stats)
+	return stats.Length, err
+}
+
+func (c *Client) take(ctx context.Context, endpoint string, wait time.Duration) (interface{}, int, error) {
+	var query url.Values
+	if wait > 0 {
+		query = url.Values{"wait": {wait.String()}}
+	}
+
+	var item itemJSON
+	if err := c.call(ctx, http.MethodPost, endpoint, query, nil, wait, &item); err != nil {
+		return nil, 0, err
+	}
+
+	return item.Value, item.Priority, nil
+}
+
+// Sends a request and decodes the reply into out. The call may take the client timeout plus wait
+// unless the context has a deadline. GET requests are retried after network errors and unavailable servers.
+func (c *Client) call(ctx context.Context, method, endpoint string, query url.Values, body []byte, wait time.Duration, out interface{}) error {
+	if _, ok := ctx.Deadline(); !ok && c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout+wait)
+		defer cancel()
+	}
+
+	u := c.url + endpoint
+	if query != nil {
+		u += "?" + query.Encode()
+	}
+
+	retries := 0
+	if method == http.MethodGet {
+		retries = c.Retries
+	}
+
+	backoff := c.Backoff
+
+	for attempt := 0; ; attempt += 1 {
+		retry, err := c.send(ctx, method, u, body, out)
+
+		if err == nil || !retry || attempt >= retries {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Sends a request once. Returns true if the request failed and may be retried.
+func (c *Client) send(ctx context.Context, method, u string, body []byte, out interface{}) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		retry := resp.StatusCode == http.StatusBadGateway ||
+			resp.StatusCode == http.StatusServiceUnavailable ||
+			resp.StatusCode == http.StatusGatewayTimeout
+
+		return retry, replyError(resp.StatusCode, b)
+	}
+
+	if out == nil {
+		return false, nil
+	}
+
+	return false, json.Unmarshal(b, out)
+}
+
+// Returns the error of a failed reply, one of the errors of the queue if the server reported one.
+func replyError(code int, body []byte) error {
+	var reply errorJSON
+
+	if err := json.Unmarshal(body, &reply); err != nil || reply.Error == "" {
+		return fmt.Errorf("client: server replied %s", http.StatusText(code))
+	}
+
+	for _, err := range queueErrors {
+		if reply.Error == err.Error() {
+			return err
+		}
+	}
+
+	return errors.New(reply.Error)
+}
+
+func valueQuery(v interface{}) (url.Values, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return url.Values{"value": {string(b)}}, nil
+}
@@ -0,0 +1,222 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	spq "github.com/theodesp/go-shuffled-queue"
+	"github.com/theodesp/go-shuffled-queue/queuetest"
+	"github.com/theodesp/go-shuffled-queue/server"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type ClientSuite struct {
+	server *server.Server
+	http   *httptest.Server
+}
+
+var _ = Suite(&ClientSuite{})
+
+func (s *ClientSuite) SetUpTest(c *C) {
+	s.server = server.NewServer()
+	s.http = httptest.NewServer(s.server)
+}
+
+func (s *ClientSuite) TearDownTest(c *C) {
+	s.http.Close()
+}
+
+// Uses a queue the same way whether it is in process or remote.
+func useQueue(c *C, q spq.Queue) {
+	q.AddPriority("hello", 1)
+	q.AddPriority("world", 5)
+	q.Add("welt")
+
+	first, ok := q.First()
+	c.Assert(ok, Equals, true)
+	c.Assert(first, Equals, "welt")
+
+	last, _ := q.Last()
+	c.Assert(last, Equals, "world")
+
+	priority, ok := q.FindPriority("hello")
+	c.Assert(ok, Equals, true)
+	c.Assert(priority, Equals, 1)
+
+	c.Assert(q.Remove("hello"), Equals, true)
+	c.Assert(q.Remove("hello"), Equals, false)
+
+	_, ok = q.FindPriority("hello")
+	c.Assert(ok, Equals, false)
+
+	item, _ := q.Pop()
+	c.Assert(item, Equals, "world")
+	item, _ = q.Shift()
+	c.Assert(item, Equals, "welt")
+
+	item, ok = q.Pop()
+	c.Assert(item, IsNil)
+	c.Assert(ok, Equals, false)
+}
+
+// Test the client and the in process queue can be swapped.
+func (s *ClientSuite) TestQueue(c *C) {
+	useQueue(c, spq.NewSPQ())
+	useQueue(c, NewClient(s.http.URL, "jobs"))
+}
+
+// Test the client conforms to the behaviour of the in process queue.
+func (s *ClientSuite) TestConformance(c *C) {
+	s.server.NewQueue = func(name string) *spq.ShuffledPriorityQueue {
+		q := spq.NewSPQ()
+		q.SetTieBreaker(spq.NewRandomTieBreaker(rand.NewSource(1)))
+		return q
+	}
+	queues := 0
+
+	c.Assert(queuetest.Check(func() spq.Queue {
+		queues += 1
+		return NewClient(s.http.URL, fmt.Sprintf("conformance-%d", queues))
+	}), IsNil)
+}
+
+// Test the methods taking a context return the errors of the queue.
+func (s *ClientSuite) TestErrors(c *C) {
+	s.server.NewQueue = func(name string) *spq.ShuffledPriorityQueue {
+		q := spq.NewSPQ()
+		q.SetCapacity(1)
+		return q
+	}
+	client := NewClient(s.http.URL, "jobs")
+	ctx := context.Background()
+
+	_, _, err := client.PopContext(ctx)
+	c.Assert(err, Equals, spq.ErrEmpty)
+	_, err = client.FirstContext(ctx)
+	c.Assert(err, Equals, spq.ErrEmpty)
+	_, err = client.FindPriorityContext(ctx, "hello")
+	c.Assert(err, Equals, spq.ErrNotFound)
+
+	c.Assert(client.AddPriorityContext(ctx, "hello", 2), IsNil)
+	c.Assert(client.AddPriorityContext(ctx, "world", 2), Equals, spq.ErrFull)
+	c.Assert(client.AddPriorityContext(ctx, func() {}, 2), NotNil)
+
+	length, err := client.LenContext(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(length, Equals, 1)
+
+	v, priority, err := client.ShiftContext(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(v, Equals, "hello")
+	c.Assert(priority, Equals, 2)
+}
+
+// Test popping from a rate limited queue returns ErrRateLimited.
+func (s *ClientSuite) TestRateLimited(c *C) {
+	s.server.NewQueue = func(name string) *spq.ShuffledPriorityQueue {
+		q := spq.NewSPQ()
+		q.SetRateLimit(2, 0.001, 1)
+		return q
+	}
+	client := NewClient(s.http.URL, "jobs")
+	ctx := context.Background()
+
+	c.Assert(client.AddPriorityContext(ctx, "hello", 2), IsNil)
+	c.Assert(client.AddPriorityContext(ctx, "world", 2), IsNil)
+
+	_, _, err := client.PopContext(ctx)
+	c.Assert(err, IsNil)
+	_, _, err = client.PopContext(ctx)
+	c.Assert(err, Equals, spq.ErrRateLimited)
+
+	length, err := client.LenContext(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(length, Equals, 1)
+}
+
+// Test values are received the way encoding/json decodes them.
+func (s *ClientSuite) TestValues(c *C) {
+	client := NewClient(s.http.URL, "my jobs/1")
+
+	client.AddPriority(map[string]interface{}{"id": 7}, 1)
+
+	priority, ok := client.FindPriority(map[string]interface{}{"id": 7})
+	c.Assert(ok, Equals, true)
+	c.Assert(priority, Equals, 1)
+
+	item, _ := client.Pop()
+	c.Assert(item, DeepEquals, map[string]interface{}{"id": 7.0})
+}
+
+// Test a blocking pop waits for a value added by another client.
+func (s *ClientSuite) TestBlockingPop(c *C) {
+	client := NewClient(s.http.URL, "jobs")
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		NewClient(s.http.URL, "jobs").AddPriority("hello", 3)
+	}()
+
+	v, priority, err := client.BlockingPop(context.Background(), 5*time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(v, Equals, "hello")
+	c.Assert(priority, Equals, 3)
+
+	_, _, err = client.BlockingShift(context.Background(), 10*time.Millisecond)
+	c.Assert(err, Equals, spq.ErrEmpty)
+}
+
+// Test a blocking pop gives up when the context is done.
+func (s *ClientSuite) TestBlockingPopDeadline(c *C) {
+	client := NewClient(s.http.URL, "jobs")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, _, err := client.BlockingPop(ctx, time.Minute)
+	c.Assert(err, NotNil)
+}
+
+// Test reading calls are retried when the server is unavailable and other calls are not.
+func (s *ClientSuite) TestRetries(c *C) {
+	var calls int32
+
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		s.server.ServeHTTP(w, r)
+	}))
+	defer flaky.Close()
+
+	client := NewClient(flaky.URL, "jobs")
+	client.Backoff = time.Millisecond
+
+	err := client.AddPriorityContext(context.Background(), "hello", 1)
+	c.Assert(err, NotNil)
+	c.Assert(atomic.LoadInt32(&calls), Equals, int32(1))
+
+	c.Assert(client.AddPriorityContext(context.Background(), "hello", 1), IsNil)
+
+	priority, ok := client.FindPriority("hello")
+	c.Assert(ok, Equals, true)
+	c.Assert(priority, Equals, 1)
+	c.Assert(atomic.LoadInt32(&calls), Equals, int32(4))
+
+	client.Retries = 0
+	_, ok = client.FindPriority("hello")
+	c.Assert(ok, Equals, false)
+}
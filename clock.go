@@ -0,0 +1,30 @@
+package go_shuffled_queue
+
+import (
+	"time"
+)
+
+// A Clock tells the time to the queue. It can be replaced to control time in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+// The clock of the operating system.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Sets the clock used to timestamp the items added to the queue and to refill its rate limits.
+// Rate limits start refilling from the time of the new clock.
+func (spq *ShuffledPriorityQueue) SetClock(clock Clock) {
+	spq.clock = clock
+
+	if len(spq.limits) > 0 {
+		now := clock.Now()
+		for _, tb := range spq.limits {
+			tb.last = now
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Command spq writes lines or NDJSON records in priority order, shuffling the ones with the same priority.
+//
+// Usage:
+//
+//	spq [flags] [file ...]
+//
+// Records are read from the files, or from the standard input if there is none or for "-".
+// The priority of a record is taken from a column, an NDJSON field or a regular expression capture,
+// records without one of these flags all have the same priority and are simply shuffled.
+//
+// Examples:
+//
+//	spq -column 2 scores.tsv            highest scores first, ties shuffled
+//	spq -field meta.prio -shift a.ndjson lowest priorities first
+//	spq -regex 'P([0-9]+)' -head 10     the ten most important lines
+//	spq -seed 42 tests.txt              a reproducible shuffle
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	spq "github.com/theodesp/go-shuffled-queue"
+)
+
+// The longest line read.
+const maxLineSize = 16 << 20
+
+// Where the priority of a record is taken from.
+type options struct {
+	column    int
+	delimiter string
+	field     string
+	regex     *regexp.Regexp
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// Runs the command and returns its exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("spq", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var opts options
+	fs.IntVar(&opts.column, "column", 0, "take the priority from this column, starting at 1")
+	fs.StringVar(&opts.delimiter, "delimiter", "", "column delimiter (default runs of white space)")
+	fs.StringVar(&opts.field, "field", "", "take the priority from this field of NDJSON records, dots separate nested fields")
+	regex := fs.String("regex", "", "take the priority from the first capture group of this regular expression")
+	shift := fs.Bool("shift", false, "write the lowest priorities first instead of the highest")
+	seed := fs.Int64("seed", 0, "seed of the shuffle (default random)")
+	head := fs.Int("head", 0, "write only the first N records")
+	sample := fs.Int("sample", 0, "write N distinct records picked at random from the highest priorities")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *regex != "" {
+		re, err := regexp.Compile(*regex)
+		if err != nil {
+			fmt.Fprintf(stderr, "spq: %v\n", err)
+			return 2
+		}
+
+		if re.NumSubexp() < 1 {
+			fmt.Fprintln(stderr, "spq: the regular expression has no capture group")
+			return 2
+		}
+
+		opts.regex = re
+	}
+
+	src := rand.NewSource(time.Now().UnixNano())
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			src = rand.NewSource(*seed)
+		}
+	})
+
+	q := spq.NewSPQ()
+	q.SetTieBreaker(spq.NewRandomTieBreaker(src))
+	q.SetSampleSource(src)
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	// Every line is pushed so that repeated lines are all written
+	add := func(line string, priority int) error {
+		_, err := q.Push(line, priority)
+		return err
+	}
+
+	// Samples are distinct records so repeated lines, which have the same priority, are added once
+	if *sample > 0 {
+		add = func(line string, priority int) error {
+			return q.TryAddPriority(line, priority)
+		}
+	}
+
+	for _, name := range files {
+		if err := read(name, stdin, opts, add); err != nil {
+			fmt.Fprintf(stderr, "spq: %v\n", err)
+			return 1
+		}
+	}
+
+	w := bufio.NewWriter(stdout)
+	defer w.Flush()
+
+	if *sample > 0 {
+		for _, line := range q.SampleN(*sample) {
+			fmt.Fprintln(w, line)
+		}
+		return 0
+	}
+
+	take := q.Pop
+	if *shift {
+		take = q.Shift
+	}
+
+	for n := 0; *head <= 0 || n < *head; n += 1 {
+		line, ok := take()
+		if !ok {
+			break
+		}
+		fmt.Fprintln(w, line)
+	}
+
+	return 0
+}
+
+// Adds every record of the file with its priority.
+func read(name string, stdin io.Reader, opts options, add func(line string, priority int) error) error {
+	r := stdin
+
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		r = f
+	} else {
+		name = "standard input"
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	for n := 1; scanner.Scan(); n += 1 {
+		line := scanner.Text()
+
+		priority, err := opts.priority(line)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", name, n, err)
+		}
+
+		if err := add(line, priority); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Returns the priority of a record.
+func (opts options) priority(line string) (int, error) {
+	switch {
+	case opts.column > 0:
+		var columns []string
+		if opts.delimiter == "" {
+			columns = strings.Fields(line)
+		} else {
+			columns = strings.Split(line, opts.delimiter)
+		}
+
+		if len(columns) < opts.column {
+			return 0, fmt.Errorf("no column %d", opts.column)
+		}
+
+		return parsePriority(strings.TrimSpace(columns[opts.column-1]))
+	case opts.field != "":
+		return fieldPriority(line, opts.field)
+	case opts.regex != nil:
+		match := opts.regex.FindStringSubmatch(line)
+		if match == nil {
+			return 0, errors.New("no match for the regular expression")
+		}
+
+		return parsePriority(match[1])
+	}
+
+	return spq.DefaultPriority, nil
+}
+
+// Returns the priority held by a field of an NDJSON record.
+func fieldPriority(line, field string) (int, error) {
+	var v interface{}
+
+	d := json.NewDecoder(bytes.NewReader([]byte(line)))
+	d.UseNumber()
+
+	if err := d.Decode(&v); err != nil {
+		return 0, err
+	}
+
+	for _, name := range strings.Split(field, ".") {
+		object, ok := v.(map[string]interface{})
+		if !ok {
+			return 0, fmt.Errorf("no field %s", field)
+		}
+
+		if v, ok = object[name]; !ok {
+			return 0, fmt.Errorf("no field %s", field)
+		}
+	}
+
+	switch p := v.(type) {
+	case json.Number:
+		return parsePriority(p.String())
+	case string:
+		return parsePriority(p)
+	}
+
+	return 0, fmt.Errorf("field %s is not a number", field)
+}
+
+// Parses an integer priority, accepting numbers such as 3.0 or 1e3 that hold an integer.
+func parsePriority(s string) (int, error) {
+	if priority, err := strconv.Atoi(s); err == nil {
+		return priority, nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f != math.Trunc(f) || math.Abs(f) > math.MaxInt32 {
+		return 0, fmt.Errorf("priority %q is not an integer", s)
+	}
+
+	return int(f), nil
+}
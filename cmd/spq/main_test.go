@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type CommandSuite struct{}
+
+var _ = Suite(&CommandSuite{})
+
+// Runs the command and returns its exit code, its output lines and its error output.
+func runSPQ(input string, args ...string) (int, []string, string) {
+	var stdout, stderr bytes.Buffer
+
+	code := run(args, strings.NewReader(input), &stdout, &stderr)
+	lines := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+	if stdout.Len() == 0 {
+		lines = []string{}
+	}
+
+	return code, lines, stderr.String()
+}
+
+const scores = "alice 3\nbob 5\ncarol 3\ndave 1\nbob 5\n"
+
+// Test records are written by descending priority taken from a column, repeated lines included.
+func (s *CommandSuite) TestColumn(c *C) {
+	code, lines, _ := runSPQ(scores, "-column", "2")
+
+	c.Assert(code, Equals, 0)
+	c.Assert(lines, HasLen, 5)
+	c.Assert(lines[:2], DeepEquals, []string{"bob 5", "bob 5"})
+
+	middle := append([]string{}, lines[2:4]...)
+	sort.Strings(middle)
+	c.Assert(middle, DeepEquals, []string{"alice 3", "carol 3"})
+	c.Assert(lines[4], Equals, "dave 1")
+}
+
+// Test -shift writes the lowest priorities first and -head limits the output.
+func (s *CommandSuite) TestShiftHead(c *C) {
+	code, lines, _ := runSPQ("a,7\nb,-2\nc,4\n", "-column", "2", "-delimiter", ",", "-shift", "-head", "2")
+
+	c.Assert(code, Equals, 0)
+	c.Assert(lines, DeepEquals, []string{"b,-2", "c,4"})
+}
+
+// Test the priority of NDJSON records is taken from a nested field.
+func (s *CommandSuite) TestField(c *C) {
+	input := `{"name": "a", "meta": {"prio": 2}}` + "\n" + `{"name": "b", "meta": {"prio": "9"}}` + "\n"
+	code, lines, _ := runSPQ(input, "-field", "meta.prio")
+
+	c.Assert(code, Equals, 0)
+	c.Assert(lines, DeepEquals, []string{`{"name": "b", "meta": {"prio": "9"}}`, `{"name": "a", "meta": {"prio": 2}}`})
+}
+
+// Test the priority is taken from the first capture group of a regular expression.
+func (s *CommandSuite) TestRegex(c *C) {
+	code, lines, _ := runSPQ("fix P2 bug\nP10 outage\nP1 typo\n", "-regex", `P([0-9]+)`, "-shift")
+
+	c.Assert(code, Equals, 0)
+	c.Assert(lines, DeepEquals, []string{"P1 typo", "fix P2 bug", "P10 outage"})
+}
+
+// Test the same seed gives the same shuffle.
+func (s *CommandSuite) TestSeed(c *C) {
+	input := "a\nb\nc\nd\ne\nf\ng\nh\n"
+
+	_, first, _ := runSPQ(input, "-seed", "42")
+	_, second, _ := runSPQ(input, "--seed", "42")
+	c.Assert(first, DeepEquals, second)
+	c.Assert(first, HasLen, 8)
+
+	_, first, _ = runSPQ(input, "-seed", "7", "-sample", "3")
+	_, second, _ = runSPQ(input, "-seed", "7", "-sample", "3")
+	c.Assert(first, DeepEquals, second)
+	c.Assert(first, HasLen, 3)
+}
+
+// Test -sample picks distinct records from the highest priorities first.
+func (s *CommandSuite) TestSample(c *C) {
+	code, lines, _ := runSPQ(scores, "-column", "2", "-sample", "3")
+
+	c.Assert(code, Equals, 0)
+	c.Assert(lines[0], Equals, "bob 5")
+	sort.Strings(lines[1:])
+	c.Assert(lines[1:], DeepEquals, []string{"alice 3", "carol 3"})
+
+	_, lines, _ = runSPQ("a\nb\na\na\n", "-sample", "3")
+	sort.Strings(lines)
+	c.Assert(lines, DeepEquals, []string{"a", "b"})
+}
+
+// Test records are read from files, with - standing for the standard input.
+func (s *CommandSuite) TestFiles(c *C) {
+	dir := c.MkDir()
+	name := filepath.Join(dir, "scores.txt")
+	c.Assert(os.WriteFile(name, []byte("x 9\n"), 0644), IsNil)
+
+	code, lines, _ := runSPQ("y 1\n", "-column", "2", name, "-")
+	c.Assert(code, Equals, 0)
+	c.Assert(lines, DeepEquals, []string{"x 9", "y 1"})
+
+	code, _, stderr := runSPQ("", filepath.Join(dir, "missing.txt"))
+	c.Assert(code, Equals, 1)
+	c.Assert(stderr, Matches, "spq: open .*missing.txt: no such file or directory\n")
+}
+
+// Test records without a priority and bad flags are reported.
+func (s *CommandSuite) TestErrors(c *C) {
+	code, _, stderr := runSPQ("a 1\nb\n", "-column", "2")
+	c.Assert(code, Equals, 1)
+	c.Assert(stderr, Equals, "spq: standard input:2: no column 2\n")
+
+	code, _, stderr = runSPQ("a x\n", "-column", "2")
+	c.Assert(code, Equals, 1)
+	c.Assert(stderr, Equals, "spq: standard input:1: priority \"x\" is not an integer\n")
+
+	code, _, stderr = runSPQ("{}\n", "-field", "prio")
+	c.Assert(stderr, Equals, "spq: standard input:1: no field prio\n")
+
+	code, _, stderr = runSPQ("a\n", "-regex", "a")
+	c.Assert(code, Equals, 2)
+	c.Assert(stderr, Equals, "spq: the regular expression has no capture group\n")
+
+	code, _, _ = runSPQ("a\n", "-head")
+	c.Assert(code, Equals, 2)
+}
+
+// Benchmark shuffling c.N lines of the same priority, which takes logarithmic time per line.
+func (s *CommandSuite) BenchmarkShuffle(c *C) {
+	var input strings.Builder
+	for i := 0; i < c.N; i += 1 {
+		fmt.Fprintln(&input, i)
+	}
+
+	c.ResetTimer()
+	run([]string{"-seed", "1"}, strings.NewReader(input.String()), io.Discard, io.Discard)
+}
@@ -0,0 +1,49 @@
+// Command spqd serves named shuffled priority queues over HTTP and optionally the Redis protocol.
+//
+// Usage:
+//
+//	spqd [-addr :7070] [-resp-addr :7379] [-capacity n] [-max-wait 1m]
+//
+// See the server package for the endpoints and commands.
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"net/http"
+
+	spq "github.com/theodesp/go-shuffled-queue"
+	"github.com/theodesp/go-shuffled-queue/server"
+)
+
+func main() {
+	addr := flag.String("addr", ":7070", "address to listen on for HTTP")
+	respAddr := flag.String("resp-addr", "", "address to listen on for the Redis protocol, disabled if empty")
+	capacity := flag.Uint("capacity", 0, "maximum number of items of every queue, 0 for unbounded")
+	maxWait := flag.Duration("max-wait", server.DefaultMaxWait, "longest a blocking pop waits for an item")
+	flag.Parse()
+
+	s := server.NewServer()
+	s.MaxWait = *maxWait
+	s.NewQueue = func(name string) *spq.ShuffledPriorityQueue {
+		q := spq.NewSPQ()
+		q.SetCapacity(*capacity)
+		return q
+	}
+
+	if *respAddr != "" {
+		l, err := net.Listen("tcp", *respAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Printf("spqd: listening on %s for the Redis protocol", *respAddr)
+		go func() {
+			log.Fatal(s.ServeRESP(l))
+		}()
+	}
+
+	log.Printf("spqd: listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, s))
+}
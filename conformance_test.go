@@ -0,0 +1,47 @@
+package go_shuffled_queue_test
+
+import (
+	"math/rand"
+
+	. "gopkg.in/check.v1"
+
+	spq "github.com/theodesp/go-shuffled-queue"
+	"github.com/theodesp/go-shuffled-queue/queuetest"
+)
+
+// Runs the conformance checks shared by every backend. Being registered with gocheck it runs along
+// with the suites of the package.
+type ConformanceSuite struct{}
+
+var _ = Suite(&ConformanceSuite{})
+
+func newSeededSPQ() *spq.ShuffledPriorityQueue {
+	q := spq.NewSPQ()
+	q.SetTieBreaker(spq.NewRandomTieBreaker(rand.NewSource(1)))
+
+	return q
+}
+
+// Test the in process queue conforms.
+func (s *ConformanceSuite) TestConformance(c *C) {
+	c.Assert(queuetest.Check(func() spq.Queue {
+		return newSeededSPQ()
+	}), IsNil)
+}
+
+// Test the queue safe for concurrent use conforms.
+func (s *ConformanceSuite) TestSyncQueueConformance(c *C) {
+	c.Assert(queuetest.Check(func() spq.Queue {
+		return spq.NewSyncQueue(newSeededSPQ())
+	}), IsNil)
+}
+
+// Test the sharded queue conforms. The approximate mode does not, as it may skip the highest priority.
+func (s *ConformanceSuite) TestShardedQueueConformance(c *C) {
+	c.Assert(queuetest.Check(func() spq.Queue {
+		q := spq.NewShardedQueue(4)
+		q.SetRandSource(rand.NewSource(1))
+
+		return q
+	}), IsNil)
+}
@@ -0,0 +1,34 @@
+//go:build spqdebug
+
+package go_shuffled_queue
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Validates the queue after the operation and panics with a dump of its state on any violation.
+// Only built with the spqdebug build tag.
+func (spq *ShuffledPriorityQueue) checkInvariants(op string) {
+	if err := spq.Validate(); err != nil {
+		panic(fmt.Sprintf("%v after %s\n%s", err, op, spq.dump()))
+	}
+}
+
+// Returns a readable dump of the internal state of the queue.
+func (spq *ShuffledPriorityQueue) dump() string {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "length: %d\n", spq.length)
+	fmt.Fprintf(&buf, "keys: %v\n", spq.keys)
+
+	for priority, b := range spq.priorities {
+		fmt.Fprintf(&buf, "priority %d: %d items, %d occurrences, %d slots, %d holes, %d indexed, %d refs\n",
+			priority, b.Cardinality(), b.size, len(b.slots), b.holes, len(b.index), b.refs)
+		fmt.Fprintf(&buf, "  set: %v\n", b.ToSlice())
+		fmt.Fprintf(&buf, "  order: %v\n", b.items())
+		fmt.Fprintf(&buf, "  counts: %v\n", b.counts)
+	}
+
+	return buf.String()
+}
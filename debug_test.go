@@ -0,0 +1,29 @@
+//go:build spqdebug
+
+package go_shuffled_queue
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+// Test debug builds panic with a state dump when a mutation leaves the queue corrupt.
+func (s *MySuite) TestDebugPanicsOnCorruption(c *C) {
+	spq := newRangeSPQ()
+	spq.length += 1
+
+	c.Assert(func() { spq.Add("hello") }, PanicMatches, `(?s)shuffled queue: length is 8 but the queue holds 7 items after AddPriority\nlength: 8\nkeys: \[-3 0 1 3 5 10\]\n.*`)
+}
+
+// Test debug builds do not panic on consistent queues.
+func (s *MySuite) TestDebugDoesNotPanic(c *C) {
+	spq := newRangeSPQ()
+
+	spq.Add("hello")
+	spq.Pop()
+	spq.Shift()
+	spq.Remove("world")
+	spq.PopRange(0, 3)
+	spq.RemovePriority(10)
+
+	c.Assert(spq.Validate(), IsNil)
+}
@@ -0,0 +1,274 @@
+package go_shuffled_queue
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// How many times the dispatcher runs the handler on an item unless told otherwise.
+const DefaultMaxAttempts = 3
+
+// How long the dispatcher waits before retrying an item unless told otherwise.
+var DefaultBackoff = ExponentialBackoff(100*time.Millisecond, 10*time.Second)
+
+// Returns a backoff doubling the delay with every attempt, starting from base and never exceeding max.
+func ExponentialBackoff(base, max time.Duration) func(attempts int) time.Duration {
+	return func(attempts int) time.Duration {
+		delay := base
+		for i := 1; i < attempts && delay < max; i += 1 {
+			delay *= 2
+		}
+
+		if delay > max {
+			return max
+		}
+		return delay
+	}
+}
+
+// The callbacks a dispatcher reports results through. Any of them may be nil.
+// They are called from the worker that ran the handler.
+type DispatchCallbacks struct {
+	// Called when the handler succeeded.
+	OnSuccess func(env *Envelope)
+	// Called when the handler failed and the item will be added back after the delay.
+	OnRetry func(env *Envelope, err error, delay time.Duration)
+	// Called when the handler failed for the last time and the item is dropped.
+	OnFailure func(env *Envelope, err error)
+}
+
+// A Dispatcher takes items out of a queue in Pop order and runs a handler on them with a number of workers.
+// Failed items are added back to the queue after a backoff delay, with their priority lowered by the demotion,
+// until they run out of attempts.
+// The queue is not thread safe: while the dispatcher runs other goroutines may only call Feed, Stream and Close.
+// The dispatcher must be configured before Run is called.
+type Dispatcher struct {
+	spq     *ShuffledPriorityQueue
+	workers int
+	handle  func(ctx context.Context, env *Envelope) error
+
+	limits      map[int]int
+	backoff     func(attempts int) time.Duration
+	maxAttempts int
+	demotion    int
+	callbacks   DispatchCallbacks
+
+	// Guarded by the pipe lock of the queue. Pending counts the items being handled or waiting to be retried.
+	inflight map[int]int
+	pending  int
+	finished chan struct{}
+}
+
+// Creates and returns a reference to a dispatcher running handle on the items of the queue with the specified
+// number of workers. The handler context is not cancelled when the dispatcher stops so that it can finish.
+func NewDispatcher(spq *ShuffledPriorityQueue, workers int, handle func(ctx context.Context, env *Envelope) error) *Dispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+
+	return &Dispatcher{
+		spq:         spq,
+		workers:     workers,
+		handle:      handle,
+		limits:      map[int]int{},
+		backoff:     DefaultBackoff,
+		maxAttempts: DefaultMaxAttempts,
+		inflight:    map[int]int{},
+		finished:    make(chan struct{})}
+}
+
+// Sets how many items of the specified priority may be handled at once.
+// Items of a priority at its limit are left in the queue for lower priorities to run in the meantime.
+// A limit below 1 removes the limit.
+func (d *Dispatcher) SetLimit(priority, limit int) {
+	if limit < 1 {
+		delete(d.limits, priority)
+		return
+	}
+
+	d.limits[priority] = limit
+}
+
+// Sets the delay before retrying an item given how many times it has been attempted. Defaults to DefaultBackoff.
+func (d *Dispatcher) SetBackoff(backoff func(attempts int) time.Duration) {
+	d.backoff = backoff
+}
+
+// Sets how many times the handler runs on an item before it is dropped. A value below 1 retries forever.
+// Defaults to DefaultMaxAttempts.
+func (d *Dispatcher) SetMaxAttempts(attempts int) {
+	d.maxAttempts = attempts
+}
+
+// Sets how much the priority of an item is lowered every time it is retried. Defaults to 0.
+func (d *Dispatcher) SetDemotion(demotion int) {
+	d.demotion = demotion
+}
+
+// Sets the callbacks reporting the result of every handler run.
+func (d *Dispatcher) SetCallbacks(callbacks DispatchCallbacks) {
+	d.callbacks = callbacks
+}
+
+// Runs the workers until the context is done or the queue is closed and every item was handled.
+// Either way Run waits for the running handlers to finish. Once the context is done the items failing and the
+// ones waiting for a retry are added back to the queue right away so that no item is lost.
+// Returns nil once the queue is drained or the context error.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	var workers, retries sync.WaitGroup
+
+	for i := 0; i < d.workers; i += 1 {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			d.work(ctx, &retries)
+		}()
+	}
+
+	workers.Wait()
+	retries.Wait()
+
+	return ctx.Err()
+}
+
+// Runs the handler on the items taken out of the queue until there are none left or the context is done.
+func (d *Dispatcher) work(ctx context.Context, retries *sync.WaitGroup) {
+	handlerCtx := context.WithoutCancel(ctx)
+
+	for {
+		env, ok := d.next(ctx)
+		if !ok {
+			return
+		}
+
+		priority := env.Priority
+		err := d.handle(handlerCtx, env)
+		d.finish(ctx, env, priority, err, retries)
+	}
+}
+
+// Takes the next item out of the queue, waiting for one to be added or for a limit to make room.
+// Returns false once the context is done or the queue is closed and nothing is left to handle.
+func (d *Dispatcher) next(ctx context.Context) (*Envelope, bool) {
+	pipe := d.spq.pipe
+
+	for ctx.Err() == nil {
+		pipe.mu.Lock()
+		env, ok := d.take()
+		if ok {
+			pipe.broadcast(&pipe.taken)
+		}
+		drained := d.spq.closed && d.spq.length == 0 && d.pending == 0
+		added, finished := pipe.added, d.finished
+		var token <-chan time.Time
+		if !ok {
+			token = d.spq.nextToken()
+		}
+		pipe.mu.Unlock()
+
+		if ok {
+			return env, true
+		}
+
+		if drained {
+			return nil, false
+		}
+
+		select {
+		case <-added:
+		case <-finished:
+		case <-token:
+		case <-ctx.Done():
+		}
+	}
+
+	return nil, false
+}
+
+// Takes the highest priority item whose priority is below its limit and not rate limited.
+// Must be called with the pipe lock held.
+func (d *Dispatcher) take() (*Envelope, bool) {
+	defer d.spq.checkInvariants("dispatch")
+
+	for i := len(d.spq.keys) - 1; i >= 0; i -= 1 {
+		priority := d.spq.keys[i]
+		if limit, ok := d.limits[priority]; ok && d.inflight[priority] >= limit {
+			continue
+		}
+
+		if !d.spq.allow(priority) {
+			continue
+		}
+
+		d.inflight[priority] += 1
+		d.pending += 1
+
+		return d.spq.takeEnvelope(priority), true
+	}
+
+	return nil, false
+}
+
+// Records the result of the handler on an item taken out of the queue with the specified priority,
+// scheduling a retry if it failed.
+func (d *Dispatcher) finish(ctx context.Context, env *Envelope, priority int, err error, retries *sync.WaitGroup) {
+	pipe := d.spq.pipe
+	retry := err != nil && (d.maxAttempts < 1 || env.Attempts < d.maxAttempts)
+
+	pipe.mu.Lock()
+	d.inflight[priority] -= 1
+	if d.inflight[priority] == 0 {
+		delete(d.inflight, priority)
+	}
+	if !retry {
+		d.pending -= 1
+	}
+	pipe.broadcast(&d.finished)
+	pipe.mu.Unlock()
+
+	switch {
+	case err == nil:
+		if d.callbacks.OnSuccess != nil {
+			d.callbacks.OnSuccess(env)
+		}
+	case !retry:
+		if d.callbacks.OnFailure != nil {
+			d.callbacks.OnFailure(env, err)
+		}
+	default:
+		delay := d.backoff(env.Attempts)
+		if d.callbacks.OnRetry != nil {
+			d.callbacks.OnRetry(env, err, delay)
+		}
+
+		retries.Add(1)
+		go func() {
+			defer retries.Done()
+			d.retry(ctx, env, delay)
+		}()
+	}
+}
+
+// Adds a failed item back to the queue with its priority demoted once the delay passed or the context is done.
+func (d *Dispatcher) retry(ctx context.Context, env *Envelope, delay time.Duration) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	pipe := d.spq.pipe
+	pipe.mu.Lock()
+	defer pipe.mu.Unlock()
+
+	retried := *env
+	retried.Priority -= d.demotion
+	d.spq.putBack(&retried, env.Attempts)
+
+	d.pending -= 1
+	pipe.broadcast(&pipe.added)
+	pipe.broadcast(&d.finished)
+}
@@ -0,0 +1,195 @@
+package go_shuffled_queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+var errHandler = errors.New("handler failed")
+
+func noBackoff(attempts int) time.Duration {
+	return 0
+}
+
+// Test the dispatcher handles every item in Pop order and stops once the queue is closed and drained.
+func (s *MySuite) TestDispatcherDrains(c *C) {
+	spq := NewSPQ()
+	for i := 0; i < 5; i += 1 {
+		spq.AddPriority(i, i)
+	}
+	spq.Close()
+
+	var handled []interface{}
+	d := NewDispatcher(spq, 1, func(ctx context.Context, env *Envelope) error {
+		handled = append(handled, env.Value)
+		return nil
+	})
+
+	c.Assert(d.Run(context.Background()), IsNil)
+	c.Assert(handled, DeepEquals, []interface{}{4, 3, 2, 1, 0})
+	c.Assert(spq.Len(), Equals, 0)
+}
+
+// Test failed items are retried with a demoted priority until the handler succeeds.
+func (s *MySuite) TestDispatcherRetries(c *C) {
+	spq := NewSPQ()
+	spq.AddPriority("hello", 10)
+	spq.Close()
+
+	d := NewDispatcher(spq, 2, func(ctx context.Context, env *Envelope) error {
+		if env.Attempts < 3 {
+			return errHandler
+		}
+		return nil
+	})
+	d.SetBackoff(noBackoff)
+	d.SetDemotion(2)
+
+	var retried []int
+	var succeeded *Envelope
+	d.SetCallbacks(DispatchCallbacks{
+		OnSuccess: func(env *Envelope) {
+			succeeded = env
+		},
+		OnRetry: func(env *Envelope, err error, delay time.Duration) {
+			c.Check(err, Equals, errHandler)
+			retried = append(retried, env.Priority)
+		},
+		OnFailure: func(env *Envelope, err error) {
+			c.Errorf("unexpected failure of %v", env.Value)
+		}})
+
+	c.Assert(d.Run(context.Background()), IsNil)
+	c.Assert(retried, DeepEquals, []int{10, 8})
+	c.Assert(succeeded, NotNil)
+	c.Assert(succeeded.Value, Equals, "hello")
+	c.Assert(succeeded.Priority, Equals, 6)
+	c.Assert(succeeded.Attempts, Equals, 3)
+}
+
+// Test items are dropped once they run out of attempts.
+func (s *MySuite) TestDispatcherFailure(c *C) {
+	spq := NewSPQ()
+	spq.Add("hello")
+	spq.Close()
+
+	d := NewDispatcher(spq, 1, func(ctx context.Context, env *Envelope) error {
+		return errHandler
+	})
+	d.SetBackoff(noBackoff)
+	d.SetMaxAttempts(2)
+
+	var failed []int
+	d.SetCallbacks(DispatchCallbacks{
+		OnFailure: func(env *Envelope, err error) {
+			c.Check(err, Equals, errHandler)
+			failed = append(failed, env.Attempts)
+		}})
+
+	c.Assert(d.Run(context.Background()), IsNil)
+	c.Assert(failed, DeepEquals, []int{2})
+	c.Assert(spq.Len(), Equals, 0)
+}
+
+// Test a priority at its limit lets lower priorities run.
+func (s *MySuite) TestDispatcherLimit(c *C) {
+	spq := NewSPQ()
+	for i := 0; i < 20; i += 1 {
+		spq.AddPriority(i, 5)
+		spq.AddPriority(-i-1, 1)
+	}
+	spq.Close()
+
+	var mu sync.Mutex
+	running := map[int]int{}
+	most := map[int]int{}
+
+	d := NewDispatcher(spq, 4, func(ctx context.Context, env *Envelope) error {
+		mu.Lock()
+		running[env.Priority] += 1
+		if running[env.Priority] > most[env.Priority] {
+			most[env.Priority] = running[env.Priority]
+		}
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		running[env.Priority] -= 1
+		mu.Unlock()
+
+		return nil
+	})
+	d.SetLimit(5, 1)
+
+	c.Assert(d.Run(context.Background()), IsNil)
+	c.Assert(most[5], Equals, 1)
+	c.Assert(most[1] > 1, Equals, true)
+	c.Assert(spq.Len(), Equals, 0)
+}
+
+// Test cancelling the context lets running handlers finish and puts failed items back right away.
+func (s *MySuite) TestDispatcherShutdown(c *C) {
+	spq := NewSPQ()
+	spq.AddPriority("ok", 2)
+	spq.AddPriority("fail", 2)
+	spq.AddPriority("waiting", 1)
+
+	var started sync.WaitGroup
+	started.Add(2)
+	release := make(chan struct{})
+	var succeeded []interface{}
+
+	d := NewDispatcher(spq, 2, func(ctx context.Context, env *Envelope) error {
+		started.Done()
+		<-release
+
+		c.Check(ctx.Err(), IsNil)
+		if env.Value == "fail" {
+			return errHandler
+		}
+		return nil
+	})
+	d.SetBackoff(func(attempts int) time.Duration {
+		return time.Hour
+	})
+	d.SetDemotion(1)
+	d.SetCallbacks(DispatchCallbacks{
+		OnSuccess: func(env *Envelope) {
+			succeeded = append(succeeded, env.Value)
+		}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- d.Run(ctx)
+	}()
+
+	started.Wait()
+	cancel()
+	close(release)
+
+	c.Assert(<-done, Equals, context.Canceled)
+	c.Assert(succeeded, DeepEquals, []interface{}{"ok"})
+	c.Assert(spq.Len(), Equals, 2)
+	c.Assert(spq.Validate(), IsNil)
+
+	priority, ok := spq.FindPriority("fail")
+	c.Assert(ok, Equals, true)
+	c.Assert(priority, Equals, 1)
+}
+
+// Test the exponential backoff doubles up to its maximum.
+func (s *MySuite) TestExponentialBackoff(c *C) {
+	backoff := ExponentialBackoff(time.Second, 5*time.Second)
+
+	c.Assert(backoff(1), Equals, time.Second)
+	c.Assert(backoff(2), Equals, 2*time.Second)
+	c.Assert(backoff(3), Equals, 4*time.Second)
+	c.Assert(backoff(4), Equals, 5*time.Second)
+	c.Assert(backoff(100), Equals, 5*time.Second)
+}
@@ -0,0 +1,129 @@
+package go_shuffled_queue
+
+import (
+	"time"
+)
+
+// An Envelope holds an item taken out of the queue along with what the queue knows about it.
+type Envelope struct {
+	// The key of items added with AddKeyed, the handle of items added with Push, otherwise the value.
+	Key interface{}
+	// The value or payload of the item.
+	Value interface{}
+	// The priority the item had in the queue.
+	Priority int
+	// When the item was added to the queue according to the queue clock.
+	Enqueued time.Time
+	// How many times the item was taken out of a queue as an envelope, including this one.
+	Attempts int
+	// The tags given when the item was added.
+	Tags map[string]string
+
+	// The item as stored in the queue.
+	item interface{}
+}
+
+// What the queue remembers about an item besides its value.
+type metadata struct {
+	enqueued time.Time
+	attempts int
+	tags     map[string]string
+}
+
+// Adds the value of the envelope to the priority queue using the envelope priority, attempts and tags.
+// The enqueue time is set from the queue clock. Envelopes taken out of a queue keep their key when added back,
+// except for items added with Push which get a new handle. Adding an item that already exists with the same
+// priority does nothing. Returns ErrClosed if the queue is closed, ErrUnhashable if the item cannot be stored
+// or ErrFull if the queue is at capacity.
+func (spq *ShuffledPriorityQueue) AddEnvelope(env *Envelope) error {
+	defer spq.checkInvariants("AddEnvelope")
+
+	item := env.item
+	if item == nil {
+		item = env.Value
+	}
+
+	if _, ok := item.(*Handle); ok {
+		item = &Handle{queue: spq, value: env.Value, priority: env.Priority}
+	}
+
+	// Items already in the queue keep what the queue knows about them
+	if spq.contains(item, env.Priority) {
+		return spq.put(item, env.Value, env.Priority)
+	}
+
+	if err := spq.put(item, env.Value, env.Priority); err != nil {
+		return err
+	}
+
+	b := spq.priorities[env.Priority]
+	m := b.meta[item]
+	m.attempts = env.Attempts
+	m.tags = copyTags(env.Tags)
+	b.meta[item] = m
+
+	env.item = item
+	env.Key, _ = b.entry(item)
+
+	return nil
+}
+
+// Removes the highest priority item from the queue and returns it in an envelope.
+// Returns true if found otherwise false.
+func (spq *ShuffledPriorityQueue) PopEnvelope() (*Envelope, bool) {
+	defer spq.checkInvariants("PopEnvelope")
+
+	priority, ok := spq.allowedKey(0, len(spq.keys), true)
+	if !ok {
+		return nil, false
+	}
+
+	return spq.takeEnvelope(priority), true
+}
+
+// Removes the lowest priority item from the queue and returns it in an envelope.
+// Returns true if found otherwise false.
+func (spq *ShuffledPriorityQueue) ShiftEnvelope() (*Envelope, bool) {
+	defer spq.checkInvariants("ShiftEnvelope")
+
+	priority, ok := spq.allowedKey(0, len(spq.keys), false)
+	if !ok {
+		return nil, false
+	}
+
+	return spq.takeEnvelope(priority), true
+}
+
+// Removes an item picked by the tie breaker from the bucket of the specified priority.
+// Returns the item in an envelope counting one more attempt.
+func (spq *ShuffledPriorityQueue) takeEnvelope(priority int) *Envelope {
+	item := spq.pick(priority)
+	b := spq.priorities[priority]
+	key, payload := b.entry(item)
+	m := b.meta[item]
+
+	env := Envelope{
+		Key:      key,
+		Value:    payload,
+		Priority: priority,
+		Enqueued: m.enqueued,
+		Attempts: m.attempts + 1,
+		Tags:     copyTags(m.tags),
+		item:     item}
+
+	spq.remove(item, priority)
+	return &env
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	if tags == nil {
+		return nil
+	}
+
+	c := make(map[string]string, len(tags))
+	for k, v := range tags {
+		c[k] = v
+	}
+
+	return c
+}
@@ -0,0 +1,117 @@
+package go_shuffled_queue
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+// A clock moving forward by one second every time it is read.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.now = c.now.Add(time.Second)
+	return c.now
+}
+
+// Test PopEnvelope and ShiftEnvelope return the value with its metadata.
+func (s *MySuite) TestPopEnvelope(c *C) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	spq := NewSPQ()
+	spq.SetClock(clock)
+
+	spq.AddPriority("hello", 1)
+	spq.AddPriority("world", 5)
+
+	env, ok := spq.PopEnvelope()
+	c.Assert(ok, Equals, true)
+	c.Assert(env.Key, Equals, "world")
+	c.Assert(env.Value, Equals, "world")
+	c.Assert(env.Priority, Equals, 5)
+	c.Assert(env.Enqueued, Equals, time.Unix(2, 0))
+	c.Assert(env.Attempts, Equals, 1)
+	c.Assert(env.Tags, IsNil)
+
+	env, ok = spq.ShiftEnvelope()
+	c.Assert(ok, Equals, true)
+	c.Assert(env.Value, Equals, "hello")
+	c.Assert(env.Enqueued, Equals, time.Unix(1, 0))
+
+	env, ok = spq.PopEnvelope()
+	c.Assert(env, IsNil)
+	c.Assert(ok, Equals, false)
+}
+
+// Test AddEnvelope keeps tags and counts attempts when an item is requeued.
+func (s *MySuite) TestAddEnvelopeRequeue(c *C) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	spq := NewSPQ()
+	spq.SetClock(clock)
+
+	tags := map[string]string{"producer": "billing"}
+	c.Assert(spq.AddEnvelope(&Envelope{Value: "invoice", Priority: 3, Tags: tags}), IsNil)
+	tags["producer"] = "changed"
+
+	env, _ := spq.PopEnvelope()
+	c.Assert(env.Tags, DeepEquals, map[string]string{"producer": "billing"})
+	c.Assert(env.Attempts, Equals, 1)
+
+	c.Assert(spq.AddEnvelope(env), IsNil)
+	env, _ = spq.PopEnvelope()
+	c.Assert(env.Attempts, Equals, 2)
+	c.Assert(env.Enqueued, Equals, time.Unix(2, 0))
+	c.Assert(spq.Validate(), IsNil)
+}
+
+// Test AddEnvelope keeps the key of keyed items and gives pushed items a new handle.
+func (s *MySuite) TestAddEnvelopeKeys(c *C) {
+	spq := NewSPQ()
+
+	spq.AddKeyed("a", job{name: "build"}, 1)
+	env, _ := spq.PopEnvelope()
+	c.Assert(spq.AddEnvelope(env), IsNil)
+
+	payload, ok := spq.GetKey("a")
+	c.Assert(ok, Equals, true)
+	c.Assert(payload, DeepEquals, job{name: "build"})
+	spq.RemoveKey("a")
+
+	h, _ := spq.Push([]int{1}, 2)
+	env, _ = spq.PopEnvelope()
+	c.Assert(env.Key, Equals, h)
+	c.Assert(spq.AddEnvelope(env), IsNil)
+
+	nh := env.Key.(*Handle)
+	c.Assert(nh == h, Equals, false)
+	c.Assert(spq.Remove(h), Equals, false)
+
+	v, ok := spq.Value(nh)
+	c.Assert(ok, Equals, true)
+	c.Assert(v, DeepEquals, []int{1})
+}
+
+// Test AddEnvelope reports the same errors as TryAddPriority.
+func (s *MySuite) TestAddEnvelopeErrors(c *C) {
+	spq := NewSPQ()
+
+	c.Assert(spq.AddEnvelope(&Envelope{Value: []int{1}}), Equals, ErrUnhashable)
+
+	spq.Close()
+	c.Assert(spq.AddEnvelope(&Envelope{Value: "hello"}), Equals, ErrClosed)
+}
+
+// Test Update keeps the metadata of a pushed item.
+func (s *MySuite) TestUpdateKeepsEnvelope(c *C) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	spq := NewSPQ()
+	spq.SetClock(clock)
+
+	h, _ := spq.Push("hello", 1)
+	spq.Update(h, 4)
+
+	env, _ := spq.PopEnvelope()
+	c.Assert(env.Priority, Equals, 4)
+	c.Assert(env.Enqueued, Equals, time.Unix(1, 0))
+}
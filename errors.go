@@ -0,0 +1,71 @@
+package go_shuffled_queue
+
+import (
+	"errors"
+	"reflect"
+)
+
+var (
+	// Returned when taking an item out of an empty queue.
+	ErrEmpty = errors.New("shuffled queue: queue is empty")
+	// Returned when an item is not in the queue.
+	ErrNotFound = errors.New("shuffled queue: item not found")
+	// Returned when an item cannot be used as a map key, such as a slice, a map or a struct holding one.
+	ErrUnhashable = errors.New("shuffled queue: item is not hashable")
+	// Returned when adding to a closed queue or taking an item out of a closed and empty queue.
+	ErrClosed = errors.New("shuffled queue: queue is closed")
+	// Returned when adding to a queue holding as many items as its capacity.
+	ErrFull = errors.New("shuffled queue: queue is full")
+	// Returned when taking an item out of a queue whose priorities holding items are all rate limited.
+	ErrRateLimited = errors.New("shuffled queue: every priority is rate limited")
+)
+
+// Returns true if the item can be stored in a set.
+func hashable(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+
+	return keyable(reflect.ValueOf(v))
+}
+
+// Returns true if the value can be used as a map key. Types holding interfaces are comparable
+// but using them as keys panics if the interfaces hold values that are not, so those are checked too.
+func keyable(v reflect.Value) bool {
+	if !v.Type().Comparable() {
+		return false
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		return v.IsNil() || keyable(v.Elem())
+	case reflect.Array:
+		if !mayHoldInterface(v.Type().Elem()) {
+			return true
+		}
+
+		for i := 0; i < v.Len(); i += 1 {
+			if !keyable(v.Index(i)) {
+				return false
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i += 1 {
+			if f := v.Field(i); mayHoldInterface(f.Type()) && !keyable(f) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Returns true if values of the comparable type may hold an interface.
+func mayHoldInterface(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Interface, reflect.Array, reflect.Struct:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,146 @@
+package go_shuffled_queue
+
+import (
+	"errors"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+// Test the error variants on an empty queue.
+func (s *MySuite) TestTryOnEmptyQueue(c *C) {
+	spq := NewSPQ()
+
+	for _, try := range []func() (interface{}, error){spq.TryPop, spq.TryShift, spq.TryFirst, spq.TryLast} {
+		item, err := try()
+
+		c.Assert(item, IsNil)
+		c.Assert(errors.Is(err, ErrEmpty), Equals, true)
+	}
+
+	_, err := spq.TryFindPriority("hello")
+	c.Assert(errors.Is(err, ErrNotFound), Equals, true)
+	c.Assert(errors.Is(spq.TryRemove("hello"), ErrNotFound), Equals, true)
+}
+
+// Test TryFindPriority tells a priority of -1 apart from a missing item.
+func (s *MySuite) TestTryFindPriorityNegative(c *C) {
+	spq := NewSPQ()
+	spq.AddPriority("hello", -1)
+
+	priority, err := spq.TryFindPriority("hello")
+	c.Assert(err, IsNil)
+	c.Assert(priority, Equals, -1)
+
+	_, err = spq.TryFindPriority("world")
+	c.Assert(err, Equals, ErrNotFound)
+}
+
+// Test unhashable items are rejected without panicking.
+func (s *MySuite) TestTryUnhashable(c *C) {
+	type job struct {
+		args []string
+	}
+
+	spq := NewSPQ()
+
+	c.Assert(spq.TryAdd([]int{1}), Equals, ErrUnhashable)
+	c.Assert(spq.TryAddPriority(job{}, 1), Equals, ErrUnhashable)
+	c.Assert(spq.TryAddPriority(map[string]int{}, 1), Equals, ErrUnhashable)
+	c.Assert(spq.TryRemove([]int{1}), Equals, ErrUnhashable)
+
+	_, err := spq.TryFindPriority([]int{1})
+	c.Assert(err, Equals, ErrUnhashable)
+
+	c.Assert(spq.AddPriority([]int{1}, 1), DeepEquals, []int{1})
+	c.Assert(spq.Remove([]int{1}), Equals, false)
+	c.Assert(spq.length, Equals, uint(0))
+}
+
+// Test hashable looks into the interfaces held by arrays and structs.
+func (s *MySuite) TestHashable(c *C) {
+	type pair struct {
+		key   string
+		value interface{}
+	}
+
+	c.Assert(hashable(nil), Equals, true)
+	c.Assert(hashable("hello"), Equals, true)
+	c.Assert(hashable(pair{"hello", 1}), Equals, true)
+	c.Assert(hashable([2]interface{}{1, "hello"}), Equals, true)
+	c.Assert(hashable(&[]int{1}), Equals, true)
+
+	c.Assert(hashable(pair{"hello", []int{1}}), Equals, false)
+	c.Assert(hashable([2]interface{}{1, map[int]int{}}), Equals, false)
+	c.Assert(hashable([1]pair{{"hello", pair{"world", []int{1}}}}), Equals, false)
+	c.Assert(hashable(func() {}), Equals, false)
+}
+
+// Test hashable does not allocate for plain keys.
+func (s *MySuite) TestHashableAllocations(c *C) {
+	var v interface{} = "hello"
+
+	c.Assert(testing.AllocsPerRun(100, func() {
+		hashable(v)
+	}), Equals, 0.0)
+}
+
+// Test a queue at capacity rejects new items but accepts existing ones.
+func (s *MySuite) TestTryAddFull(c *C) {
+	spq := NewSPQ()
+	spq.SetCapacity(2)
+
+	c.Assert(spq.TryAddPriority("hello", 1), IsNil)
+	c.Assert(spq.TryAddPriority("world", 1), IsNil)
+	c.Assert(spq.TryAddPriority("welt", 1), Equals, ErrFull)
+	c.Assert(spq.TryAddPriority("hello", 1), IsNil)
+	c.Assert(spq.length, Equals, uint(2))
+
+	spq.Pop()
+	c.Assert(spq.TryAddPriority("welt", 1), IsNil)
+
+	spq.SetCapacity(0)
+	c.Assert(spq.TryAddPriority("verden", 1), IsNil)
+}
+
+// Test a closed queue rejects new items and drains the existing ones.
+func (s *MySuite) TestClose(c *C) {
+	spq := NewSPQ()
+	spq.AddPriority("hello", 1)
+	spq.Close()
+
+	c.Assert(spq.Closed(), Equals, true)
+	c.Assert(spq.TryAdd("world"), Equals, ErrClosed)
+
+	item, err := spq.TryPop()
+	c.Assert(item, Equals, "hello")
+	c.Assert(err, IsNil)
+
+	_, err = spq.TryPop()
+	c.Assert(err, Equals, ErrClosed)
+
+	_, ok := spq.Pop()
+	c.Assert(ok, Equals, false)
+}
+
+// Test the error variants return items in priority order.
+func (s *MySuite) TestTryPopAndShift(c *C) {
+	spq := newRangeSPQ()
+
+	item, err := spq.TryPop()
+	c.Assert(err, IsNil)
+	c.Assert(item, Equals, "verden")
+
+	item, err = spq.TryShift()
+	c.Assert(err, IsNil)
+	c.Assert(item, Equals, "Atme")
+
+	item, err = spq.TryLast()
+	c.Assert(err, IsNil)
+	c.Assert(item, Equals, "hello")
+
+	item, err = spq.TryFirst()
+	c.Assert(err, IsNil)
+	c.Assert(item, Equals, "welt")
+	c.Assert(spq.length, Equals, uint(4))
+}
@@ -0,0 +1,190 @@
+// Package fairness implements statistical checks that a tie breaker picks items with the same priority uniformly.
+// The checks accept any value with a Pick method, such as the tie breakers of go_shuffled_queue, and take
+// the seed of every random choice they make so that they are deterministic for a deterministic tie breaker.
+package fairness
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// A Picker picks the index of one of the size items sharing the same priority.
+// Value returns the item at an index, the checks use the indexes themselves as items.
+type Picker interface {
+	Pick(priority, size int, value func(i int) interface{}) int
+}
+
+// The significance level used by the checks unless told otherwise.
+// A fair picker fails a check with this probability for a randomly chosen seed.
+const DefaultAlpha = 0.001
+
+// Picks from a bucket of size items the number of trials times.
+// Returns how many times each item was picked.
+func PickCounts(p Picker, size, trials int) []int {
+	items := newItems(size)
+	counts := make([]int, size)
+
+	for i := 0; i < trials; i += 1 {
+		counts[pick(p, items)] += 1
+	}
+
+	return counts
+}
+
+// Picks from a bucket of size items removing each picked item until the bucket is empty,
+// the way repeated pops of the same priority do, the number of trials times.
+// Returns the order each item was picked in for every trial.
+func PopOrders(p Picker, size, trials int) [][]int {
+	orders := make([][]int, trials)
+
+	for i := range orders {
+		items := newItems(size)
+		order := make([]int, 0, size)
+
+		for len(items) > 0 {
+			i := p.Pick(0, len(items), indexOf(items))
+			order = append(order, items[i])
+			items = append(items[:i], items[i+1:]...)
+		}
+
+		orders[i] = order
+	}
+
+	return orders
+}
+
+// Checks that every item of a bucket of size items is picked equally often,
+// with a chi-square test on the pick counts and a Kolmogorov–Smirnov test on the picks.
+// Returns an error describing the first test rejecting uniformity at the alpha significance level.
+func CheckPicks(p Picker, size, trials int, alpha float64, seed int64) error {
+	items := newItems(size)
+	counts := make([]int, size)
+	picks := make([]int, trials)
+
+	for i := range picks {
+		picks[i] = pick(p, items)
+		counts[picks[i]] += 1
+	}
+
+	if _, pValue := ChiSquare(counts); pValue < alpha {
+		return fmt.Errorf("fairness: pick counts %v of %d items are not uniform (chi-square p-value %.3g)", counts, size, pValue)
+	}
+
+	if _, pValue := KolmogorovSmirnov(jitter(picks, size, seed), UniformCDF); pValue < alpha {
+		return fmt.Errorf("fairness: picks of %d items are not uniform (Kolmogorov–Smirnov p-value %.3g)", size, pValue)
+	}
+
+	return nil
+}
+
+// Checks that emptying a bucket of size items by repeated picks produces every order equally often.
+// Every item must be picked at every position equally often, tested with a chi-square test per item and
+// a Kolmogorov–Smirnov test on the positions of the first item. Buckets of up to 5 items are also tested with
+// a chi-square test on the frequency of every permutation, which needs at least 5 trials per permutation.
+// Returns an error describing the first test rejecting uniformity at the alpha significance level.
+func CheckPopOrder(p Picker, size, trials int, alpha float64, seed int64) error {
+	orders := PopOrders(p, size, trials)
+
+	// One test per item, keep the overall significance at alpha
+	itemAlpha := alpha / float64(size)
+	positions := make([][]int, size)
+	for i := range positions {
+		positions[i] = make([]int, size)
+	}
+
+	firsts := make([]int, trials)
+	for t, order := range orders {
+		for position, item := range order {
+			positions[item][position] += 1
+
+			if item == 0 {
+				firsts[t] = position
+			}
+		}
+	}
+
+	for item, counts := range positions {
+		if _, pValue := ChiSquare(counts); pValue < itemAlpha {
+			return fmt.Errorf("fairness: positions %v of item %d out of %d are not uniform (chi-square p-value %.3g)", counts, item, size, pValue)
+		}
+	}
+
+	if _, pValue := KolmogorovSmirnov(jitter(firsts, size, seed), UniformCDF); pValue < alpha {
+		return fmt.Errorf("fairness: positions of item 0 out of %d are not uniform (Kolmogorov–Smirnov p-value %.3g)", size, pValue)
+	}
+
+	if size > 5 || trials < 5*factorial(size) {
+		return nil
+	}
+
+	permutations := make([]int, factorial(size))
+	for _, order := range orders {
+		permutations[rank(order)] += 1
+	}
+
+	if _, pValue := ChiSquare(permutations); pValue < alpha {
+		return fmt.Errorf("fairness: permutations of %d items are not uniform (chi-square p-value %.3g)", size, pValue)
+	}
+
+	return nil
+}
+
+// Spreads discrete values in [0, size) uniformly over their unit interval so they can be
+// compared with the continuous uniform distribution over [0, 1).
+func jitter(values []int, size int, seed int64) []float64 {
+	r := rand.New(rand.NewSource(seed))
+	samples := make([]float64, len(values))
+
+	for i, v := range values {
+		samples[i] = (float64(v) + r.Float64()) / float64(size)
+	}
+
+	return samples
+}
+
+// Returns the lexicographic rank of a permutation of [0, len(order)).
+func rank(order []int) int {
+	r := 0
+
+	for i, v := range order {
+		smaller := 0
+		for _, w := range order[i+1:] {
+			if w < v {
+				smaller += 1
+			}
+		}
+
+		r = r*(len(order)-i) + smaller
+	}
+
+	return r
+}
+
+func factorial(n int) int {
+	f := 1
+	for i := 2; i <= n; i += 1 {
+		f *= i
+	}
+
+	return f
+}
+
+func newItems(size int) []int {
+	items := make([]int, size)
+	for i := range items {
+		items[i] = i
+	}
+
+	return items
+}
+
+// Picks one of the items and returns it.
+func pick(p Picker, items []int) int {
+	return items[p.Pick(0, len(items), indexOf(items))]
+}
+
+func indexOf(items []int) func(i int) interface{} {
+	return func(i int) interface{} {
+		return items[i]
+	}
+}
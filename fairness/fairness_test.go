@@ -0,0 +1,115 @@
+package fairness
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type FairnessSuite struct{}
+
+var _ = Suite(&FairnessSuite{})
+
+type uniformPicker struct {
+	rand *rand.Rand
+}
+
+func (p uniformPicker) Pick(priority, size int, value func(i int) interface{}) int {
+	return p.rand.Intn(size)
+}
+
+// Picks the first item a bit more often than the others.
+type biasedPicker struct {
+	rand *rand.Rand
+}
+
+func (p biasedPicker) Pick(priority, size int, value func(i int) interface{}) int {
+	if p.rand.Float64() < 0.05 {
+		return 0
+	}
+	return p.rand.Intn(size)
+}
+
+type firstPicker struct{}
+
+func (firstPicker) Pick(priority, size int, value func(i int) interface{}) int {
+	return 0
+}
+
+// Test ChiSquare on perfectly uniform counts.
+func (s *FairnessSuite) TestChiSquareUniform(c *C) {
+	stat, pValue := ChiSquare([]int{10, 10, 10, 10})
+
+	c.Assert(stat, Equals, 0.0)
+	c.Assert(pValue, Equals, 1.0)
+}
+
+// Test ChiSquareExpected against known critical values.
+func (s *FairnessSuite) TestChiSquareCriticalValues(c *C) {
+	// 4 with one degree of freedom is just above the 5% critical value of 3.841
+	stat, pValue := ChiSquare([]int{60, 40})
+	c.Assert(math.Abs(stat-4) < 1e-9, Equals, true)
+	c.Assert(math.Abs(pValue-0.0455) < 1e-3, Equals, true)
+
+	// 18.307 is the 5% critical value for ten degrees of freedom
+	c.Assert(math.Abs(gammaQ(5, 18.307/2)-0.05) < 1e-4, Equals, true)
+}
+
+// Test KolmogorovSmirnov on an evenly spread sample and a skewed one.
+func (s *FairnessSuite) TestKolmogorovSmirnov(c *C) {
+	even := make([]float64, 1000)
+	skewed := make([]float64, 1000)
+	for i := range even {
+		even[i] = (float64(i) + 0.5) / 1000
+		skewed[i] = even[i] * even[i]
+	}
+
+	d, pValue := KolmogorovSmirnov(even, UniformCDF)
+	c.Assert(math.Abs(d-0.0005) < 1e-9, Equals, true)
+	c.Assert(pValue, Equals, 1.0)
+
+	_, pValue = KolmogorovSmirnov(skewed, UniformCDF)
+	c.Assert(pValue < DefaultAlpha, Equals, true)
+}
+
+// Test rank numbers every permutation once.
+func (s *FairnessSuite) TestRank(c *C) {
+	c.Assert(rank([]int{0, 1, 2}), Equals, 0)
+	c.Assert(rank([]int{2, 1, 0}), Equals, 5)
+
+	seen := map[int]bool{}
+	for _, order := range PopOrders(uniformPicker{rand.New(rand.NewSource(1))}, 4, 500) {
+		seen[rank(order)] = true
+	}
+	c.Assert(len(seen), Equals, 24)
+}
+
+// Test a uniform picker passes every check.
+func (s *FairnessSuite) TestUniformPickerPasses(c *C) {
+	for _, size := range []int{2, 3, 5, 10} {
+		p := uniformPicker{rand.New(rand.NewSource(int64(size)))}
+
+		c.Assert(CheckPicks(p, size, 10000, DefaultAlpha, 1), IsNil)
+		c.Assert(CheckPopOrder(p, size, 3000, DefaultAlpha, 1), IsNil)
+	}
+}
+
+// Test a slightly biased picker fails the checks.
+func (s *FairnessSuite) TestBiasedPickerFails(c *C) {
+	p := biasedPicker{rand.New(rand.NewSource(1))}
+
+	c.Assert(CheckPicks(p, 5, 20000, DefaultAlpha, 1), NotNil)
+	c.Assert(CheckPopOrder(p, 5, 20000, DefaultAlpha, 1), NotNil)
+}
+
+// Test a deterministic picker fails the pop order check.
+func (s *FairnessSuite) TestDeterministicPickerFails(c *C) {
+	c.Assert(CheckPopOrder(firstPicker{}, 3, 100, DefaultAlpha, 1), ErrorMatches, "fairness: positions .* of item 0 out of 3 are not uniform .*")
+}
@@ -0,0 +1,152 @@
+package fairness
+
+import (
+	"math"
+	"sort"
+)
+
+// Returns the chi-square statistic of the observed counts against a uniform distribution
+// and the probability of a statistic at least as extreme under that distribution.
+func ChiSquare(observed []int) (float64, float64) {
+	total := 0
+	for _, o := range observed {
+		total += o
+	}
+
+	expected := make([]float64, len(observed))
+	for i := range expected {
+		expected[i] = float64(total) / float64(len(observed))
+	}
+
+	return ChiSquareExpected(observed, expected)
+}
+
+// Returns the chi-square statistic of the observed counts against the expected counts
+// and the probability of a statistic at least as extreme under the expected distribution.
+func ChiSquareExpected(observed []int, expected []float64) (float64, float64) {
+	stat := 0.0
+
+	for i, o := range observed {
+		d := float64(o) - expected[i]
+		stat += d * d / expected[i]
+	}
+
+	degrees := float64(len(observed) - 1)
+	if degrees < 1 {
+		return stat, 1
+	}
+
+	return stat, gammaQ(degrees/2, stat/2)
+}
+
+// Returns the Kolmogorov–Smirnov statistic of the samples against the cumulative distribution function
+// and the asymptotic probability of a statistic at least as extreme under that distribution.
+func KolmogorovSmirnov(samples []float64, cdf func(float64) float64) (float64, float64) {
+	sorted := append([]float64{}, samples...)
+	sort.Float64s(sorted)
+
+	n := float64(len(sorted))
+	d := 0.0
+
+	for i, x := range sorted {
+		f := cdf(x)
+		d = math.Max(d, math.Max(float64(i+1)/n-f, f-float64(i)/n))
+	}
+
+	sqrtN := math.Sqrt(n)
+	return d, kolmogorovQ((sqrtN + 0.12 + 0.11/sqrtN) * d)
+}
+
+// The cumulative distribution function of the uniform distribution over [0, 1).
+func UniformCDF(x float64) float64 {
+	return math.Max(0, math.Min(1, x))
+}
+
+// Upper regularized incomplete gamma function Q(a, x).
+func gammaQ(a, x float64) float64 {
+	if x <= 0 {
+		return 1
+	}
+
+	if x < a+1 {
+		return 1 - gammaSeries(a, x)
+	}
+
+	return gammaContinuedFraction(a, x)
+}
+
+// Lower regularized incomplete gamma function P(a, x) by its series representation.
+func gammaSeries(a, x float64) float64 {
+	lg, _ := math.Lgamma(a)
+	sum := 1 / a
+	term := sum
+
+	for n := 1; n < 1000; n += 1 {
+		term *= x / (a + float64(n))
+		sum += term
+
+		if math.Abs(term) < math.Abs(sum)*1e-15 {
+			break
+		}
+	}
+
+	return sum * math.Exp(-x+a*math.Log(x)-lg)
+}
+
+// Upper regularized incomplete gamma function Q(a, x) by its continued fraction representation.
+func gammaContinuedFraction(a, x float64) float64 {
+	const tiny = 1e-300
+
+	lg, _ := math.Lgamma(a)
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+
+	for i := 1; i < 1000; i += 1 {
+		an := -float64(i) * (float64(i) - a)
+		b += 2
+
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+
+		d = 1 / d
+		delta := d * c
+		h *= delta
+
+		if math.Abs(delta-1) < 1e-15 {
+			break
+		}
+	}
+
+	return math.Exp(-x+a*math.Log(x)-lg) * h
+}
+
+// Complementary cumulative distribution function of the Kolmogorov distribution.
+func kolmogorovQ(lambda float64) float64 {
+	if lambda < 0.2 {
+		return 1
+	}
+
+	sum := 0.0
+	sign := 1.0
+
+	for j := 1; j <= 100; j += 1 {
+		term := sign * math.Exp(-2*float64(j*j)*lambda*lambda)
+		sum += term
+
+		if math.Abs(term) < 1e-12 {
+			break
+		}
+		sign = -sign
+	}
+
+	return math.Max(0, math.Min(1, 2*sum))
+}
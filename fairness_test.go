@@ -0,0 +1,76 @@
+package go_shuffled_queue
+
+import (
+	"math/rand"
+
+	"github.com/theodesp/go-shuffled-queue/fairness"
+	. "gopkg.in/check.v1"
+)
+
+var fairSizes = []int{2, 3, 5, 10}
+
+// Test the random tie breaker picks and pops items with the same priority uniformly.
+func (s *MySuite) TestRandomTieBreakerFairness(c *C) {
+	for _, size := range fairSizes {
+		tb := NewRandomTieBreaker(rand.NewSource(int64(size)))
+
+		c.Assert(fairness.CheckPicks(tb, size, 10000, fairness.DefaultAlpha, 1), IsNil)
+		c.Assert(fairness.CheckPopOrder(tb, size, 3000, fairness.DefaultAlpha, 1), IsNil)
+	}
+}
+
+// Test the shuffle tie breaker picks and pops items with the same priority uniformly.
+func (s *MySuite) TestShuffleTieBreakerFairness(c *C) {
+	for _, size := range fairSizes {
+		tb := NewShuffleTieBreaker(rand.NewSource(int64(size)))
+
+		c.Assert(fairness.CheckPicks(tb, size, 10000, fairness.DefaultAlpha, 1), IsNil)
+		c.Assert(fairness.CheckPopOrder(tb, size, 3000, fairness.DefaultAlpha, 1), IsNil)
+	}
+}
+
+// Test the weighted tie breaker with equal weights picks and pops items with the same priority uniformly.
+func (s *MySuite) TestWeightedTieBreakerFairness(c *C) {
+	for _, size := range fairSizes {
+		tb := NewWeightedTieBreaker(func(v interface{}) float64 {
+			return 2
+		}, rand.NewSource(int64(size)))
+
+		c.Assert(fairness.CheckPicks(tb, size, 10000, fairness.DefaultAlpha, 1), IsNil)
+		c.Assert(fairness.CheckPopOrder(tb, size, 3000, fairness.DefaultAlpha, 1), IsNil)
+	}
+}
+
+// Test the queue pops items with the same priority in a uniformly random order.
+func (s *MySuite) TestPopFairness(c *C) {
+	tb := NewRandomTieBreaker(rand.NewSource(3))
+	positions := make([][]int, 4)
+	for i := range positions {
+		positions[i] = make([]int, 4)
+	}
+
+	for trial := 0; trial < 4000; trial += 1 {
+		spq := NewSPQ()
+		spq.SetTieBreaker(tb)
+		for i := 0; i < 4; i += 1 {
+			spq.AddPriority(i, 1)
+		}
+
+		for position := 0; position < 4; position += 1 {
+			item, _ := spq.Pop()
+			positions[item.(int)][position] += 1
+		}
+	}
+
+	for _, counts := range positions {
+		_, pValue := fairness.ChiSquare(counts)
+		c.Assert(pValue >= fairness.DefaultAlpha/4, Equals, true)
+	}
+}
+
+// Test deterministic tie breakers are detected as not shuffling.
+func (s *MySuite) TestDeterministicTieBreakersAreNotFair(c *C) {
+	c.Assert(fairness.CheckPopOrder(NewFIFOTieBreaker(), 3, 100, fairness.DefaultAlpha, 1), NotNil)
+	c.Assert(fairness.CheckPopOrder(NewLIFOTieBreaker(), 3, 100, fairness.DefaultAlpha, 1), NotNil)
+	c.Assert(fairness.CheckPopOrder(NewRoundRobinTieBreaker(), 3, 100, fairness.DefaultAlpha, 1), NotNil)
+}
@@ -0,0 +1,175 @@
+package go_shuffled_queue
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// An obviously correct reference model of the queue: the set of (item, priority) pairs.
+type model map[modelPair]bool
+
+type modelPair struct {
+	item     int
+	priority int
+}
+
+// Returns the sorted distinct priorities of the model.
+func (m model) priorities() []int {
+	seen := map[int]bool{}
+	priorities := []int{}
+
+	for pair := range m {
+		if !seen[pair.priority] {
+			seen[pair.priority] = true
+			priorities = append(priorities, pair.priority)
+		}
+	}
+
+	sort.Ints(priorities)
+	return priorities
+}
+
+// Returns the lowest priority of the item.
+func (m model) findPriority(item int) (int, bool) {
+	for _, priority := range m.priorities() {
+		if m[modelPair{item, priority}] {
+			return priority, true
+		}
+	}
+
+	return -1, false
+}
+
+// Returns the lowest and highest priorities of the model.
+func (m model) bounds() (int, int) {
+	priorities := m.priorities()
+	return priorities[0], priorities[len(priorities)-1]
+}
+
+// The operations a fuzz input is decoded into, each one reads an item and a priority byte.
+const (
+	opAdd = iota
+	opAddPriority
+	opRemove
+	opPop
+	opShift
+	opFirst
+	opLast
+	opFindPriority
+	opCount
+)
+
+// Runs the operations encoded in the input against the queue and the reference model,
+// comparing their results and the queue state after every step.
+func FuzzQueueModel(f *testing.F) {
+	f.Add([]byte{opAddPriority, 1, 0, opAddPriority, 2, 0, opRemove, 1, 0})
+	f.Add([]byte{opAdd, 1, 0, opAddPriority, 1, 3, opPop, 0, 0, opFindPriority, 1, 0})
+	f.Add([]byte{opAddPriority, 1, 2, opAddPriority, 2, 2, opAddPriority, 3, 254, opShift, 0, 0, opLast, 0, 0, opFirst, 0, 0})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Long inputs only slow the fuzzer down, short sequences already reach every state
+		if len(data) > 3*256 {
+			return
+		}
+
+		spq := NewSPQ()
+		spq.SetTieBreaker(NewRandomTieBreaker(rand.NewSource(int64(len(data)))))
+		m := model{}
+
+		for step := 0; step+2 < len(data); step += 3 {
+			// Small domains so that items and priorities collide often
+			op := int(data[step]) % opCount
+			item := int(data[step+1]) % 8
+			priority := int(int8(data[step+2])) % 4
+
+			switch op {
+			case opAdd:
+				spq.Add(item)
+				m[modelPair{item, DefaultPriority}] = true
+
+			case opAddPriority:
+				spq.AddPriority(item, priority)
+				m[modelPair{item, priority}] = true
+
+			case opRemove:
+				expected, found := m.findPriority(item)
+				if spq.Remove(item) != found {
+					t.Fatalf("step %d: Remove(%d) returned %v", step, item, !found)
+				}
+				delete(m, modelPair{item, expected})
+
+			case opFindPriority:
+				expected, found := m.findPriority(item)
+				if p, ok := spq.FindPriority(item); p != expected || ok != found {
+					t.Fatalf("step %d: FindPriority(%d) returned %d, %v instead of %d, %v", step, item, p, ok, expected, found)
+				}
+
+			case opPop, opShift, opFirst, opLast:
+				var v interface{}
+				var ok bool
+
+				switch op {
+				case opPop:
+					v, ok = spq.Pop()
+				case opShift:
+					v, ok = spq.Shift()
+				case opFirst:
+					v, ok = spq.First()
+				case opLast:
+					v, ok = spq.Last()
+				}
+
+				if ok != (len(m) > 0) {
+					t.Fatalf("step %d: operation %d returned %v on a queue of %d items", step, op, ok, len(m))
+				}
+				if !ok {
+					if v != nil {
+						t.Fatalf("step %d: operation %d returned %v on an empty queue", step, op, v)
+					}
+					break
+				}
+
+				lowest, highest := m.bounds()
+				expected := highest
+				if op == opShift || op == opFirst {
+					expected = lowest
+				}
+
+				pair := modelPair{v.(int), expected}
+				if !m[pair] {
+					t.Fatalf("step %d: operation %d returned %v which has no priority %d", step, op, v, expected)
+				}
+				if op == opPop || op == opShift {
+					delete(m, pair)
+				}
+			}
+
+			checkModel(t, step, spq, m)
+		}
+	})
+}
+
+// Compares the size, priority order and membership of the queue with the model.
+func checkModel(t *testing.T, step int, spq *ShuffledPriorityQueue, m model) {
+	if spq.length != uint(len(m)) {
+		t.Fatalf("step %d: queue length is %d instead of %d", step, spq.length, len(m))
+	}
+
+	priorities := m.priorities()
+	if len(spq.keys) != len(priorities) || len(spq.priorities) != len(priorities) {
+		t.Fatalf("step %d: queue priorities are %v instead of %v", step, spq.keys, priorities)
+	}
+
+	for i, priority := range priorities {
+		if spq.keys[i] != priority {
+			t.Fatalf("step %d: queue priorities are %v instead of %v", step, spq.keys, priorities)
+		}
+	}
+
+	for pair := range m {
+		if !spq.contains(pair.item, pair.priority) {
+			t.Fatalf("step %d: queue lost item %d with priority %d", step, pair.item, pair.priority)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package go_shuffled_queue
+
+// A Handle refers to an item added with Push. It lets the queue remove, update and inspect
+// the item in O(1) without looking it up. A handle is invalidated once its item leaves the queue,
+// whether it is popped, shifted or removed, and only works with the queue that returned it.
+type Handle struct {
+	queue    *ShuffledPriorityQueue
+	value    interface{}
+	priority int
+}
+
+// Adds an item to the priority queue using a specified priority and returns a handle to it.
+// Every push adds a new item, so equal values and values that cannot be hashed such as slices can be pushed.
+// Returns ErrClosed if the queue is closed or ErrFull if the queue is at capacity.
+func (spq *ShuffledPriorityQueue) Push(v interface{}, priority int) (*Handle, error) {
+	defer spq.checkInvariants("Push")
+
+	h := &Handle{queue: spq, value: v, priority: priority}
+
+	if err := spq.put(h, v, priority); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// Moves the item of the handle to a new priority, even if the queue is closed or at capacity.
+// Returns false if the handle is no longer valid.
+func (spq *ShuffledPriorityQueue) Update(h *Handle, priority int) bool {
+	defer spq.checkInvariants("Update")
+
+	if h.queue != spq {
+		return false
+	}
+
+	if h.priority == priority {
+		return true
+	}
+
+	// Moving the item keeps its enqueue time, attempts and tags
+	m := spq.priorities[h.priority].meta[h]
+	spq.remove(h, h.priority)
+
+	h.queue = spq
+	h.priority = priority
+	spq.insert(h, h.value, priority)
+	spq.priorities[priority].meta[h] = m
+
+	return true
+}
+
+// Returns the priority of the item of the handle.
+// Returns false if the handle is no longer valid.
+func (spq *ShuffledPriorityQueue) Priority(h *Handle) (int, bool) {
+	if h.queue != spq {
+		return 0, false
+	}
+
+	return h.priority, true
+}
+
+// Returns the value of the item of the handle.
+// Returns false if the handle is no longer valid.
+func (spq *ShuffledPriorityQueue) Value(h *Handle) (interface{}, bool) {
+	if h.queue != spq {
+		return nil, false
+	}
+
+	return h.value, true
+}
+
+// Removes the item of the handle.
+// Returns ErrNotFound if the handle is no longer valid.
+func (spq *ShuffledPriorityQueue) removeHandle(h *Handle) error {
+	if h.queue != spq {
+		return ErrNotFound
+	}
+
+	spq.remove(h, h.priority)
+	return nil
+}
+
+// Invalidates the handles of the queue held by a bucket dropped as a whole.
+func (spq *ShuffledPriorityQueue) invalidateHandles(b *bucket) {
+	for _, item := range b.items() {
+		if h, ok := item.(*Handle); ok && h.queue == spq {
+			h.queue = nil
+		}
+	}
+}
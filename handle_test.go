@@ -0,0 +1,158 @@
+package go_shuffled_queue
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+// Test Push adds a new item for every call, even for equal or unhashable values.
+func (s *MySuite) TestPush(c *C) {
+	spq := NewSPQ()
+
+	h1, err := spq.Push("hello", 1)
+	c.Assert(err, IsNil)
+	h2, _ := spq.Push("hello", 1)
+	h3, _ := spq.Push([]int{1}, 2)
+
+	c.Assert(spq.length, Equals, uint(3))
+	c.Assert(h1 == h2, Equals, false)
+
+	v, ok := spq.Value(h3)
+	c.Assert(ok, Equals, true)
+	c.Assert(v, DeepEquals, []int{1})
+
+	item, _ := spq.Pop()
+	c.Assert(item, DeepEquals, []int{1})
+	c.Assert(spq.PeekBucket(1), DeepEquals, []interface{}{"hello", "hello"})
+}
+
+// Test Push fails on closed or full queues.
+func (s *MySuite) TestPushErrors(c *C) {
+	spq := NewSPQ()
+	spq.SetCapacity(1)
+
+	_, err := spq.Push("hello", 1)
+	c.Assert(err, IsNil)
+
+	h, err := spq.Push("hello", 1)
+	c.Assert(h, IsNil)
+	c.Assert(err, Equals, ErrFull)
+
+	spq.Close()
+	_, err = spq.Push("hello", 1)
+	c.Assert(err, Equals, ErrClosed)
+}
+
+// Test Remove with a handle removes its item only.
+func (s *MySuite) TestRemoveHandle(c *C) {
+	spq := NewSPQ()
+
+	h, _ := spq.Push("hello", 1)
+	spq.AddPriority("hello", 1)
+
+	c.Assert(spq.Remove(h), Equals, true)
+	c.Assert(spq.Remove(h), Equals, false)
+	c.Assert(spq.PeekBucket(1), DeepEquals, []interface{}{"hello"})
+}
+
+// Test Update moves the item of a handle to a new priority.
+func (s *MySuite) TestUpdateHandle(c *C) {
+	spq := NewSPQ()
+
+	h, _ := spq.Push("hello", 1)
+	spq.Push("world", 2)
+
+	c.Assert(spq.Update(h, 3), Equals, true)
+
+	priority, ok := spq.Priority(h)
+	c.Assert(ok, Equals, true)
+	c.Assert(priority, Equals, 3)
+	c.Assert(spq.keys, DeepEquals, []int{2, 3})
+
+	item, _ := spq.Pop()
+	c.Assert(item, Equals, "hello")
+}
+
+// Test Update keeps working on closed and full queues.
+func (s *MySuite) TestUpdateHandleClosed(c *C) {
+	spq := NewSPQ()
+	spq.SetCapacity(1)
+
+	h, _ := spq.Push("hello", 1)
+	spq.Close()
+
+	c.Assert(spq.Update(h, 2), Equals, true)
+	c.Assert(spq.length, Equals, uint(1))
+	c.Assert(spq.keys, DeepEquals, []int{2})
+}
+
+// Test handles are invalidated once their item leaves the queue.
+func (s *MySuite) TestHandleInvalidation(c *C) {
+	spq := NewSPQ()
+
+	popped, _ := spq.Push("hello", 3)
+	shifted, _ := spq.Push("world", 0)
+	evicted, _ := spq.Push("welt", 1)
+	kept, _ := spq.Push("verden", 2)
+
+	spq.Pop()
+	spq.Shift()
+	spq.RemovePriority(1)
+
+	for _, h := range []*Handle{popped, shifted, evicted} {
+		_, ok := spq.Priority(h)
+		c.Assert(ok, Equals, false)
+
+		_, ok = spq.Value(h)
+		c.Assert(ok, Equals, false)
+
+		c.Assert(spq.Update(h, 5), Equals, false)
+		c.Assert(spq.Remove(h), Equals, false)
+	}
+
+	c.Assert(spq.length, Equals, uint(1))
+
+	_, ok := spq.Priority(kept)
+	c.Assert(ok, Equals, true)
+}
+
+// Test handles only work with the queue that returned them.
+func (s *MySuite) TestHandleOtherQueue(c *C) {
+	spq := NewSPQ()
+	h, _ := spq.Push("hello", 1)
+
+	snapshot := spq.Snapshot()
+	c.Assert(snapshot.Remove(h), Equals, false)
+
+	snapshot.Pop()
+	_, ok := spq.Priority(h)
+	c.Assert(ok, Equals, true)
+
+	c.Assert(spq.Remove(h), Equals, true)
+	c.Assert(snapshot.Validate(), IsNil)
+	c.Assert(spq.Validate(), IsNil)
+}
+
+// Test PopKeyed returns the handle as key of pushed items.
+func (s *MySuite) TestPopKeyedHandle(c *C) {
+	spq := NewSPQ()
+	h, _ := spq.Push("hello", 1)
+
+	key, payload, ok := spq.PopKeyed()
+	c.Assert(ok, Equals, true)
+	c.Assert(key, Equals, h)
+	c.Assert(payload, Equals, "hello")
+}
+
+// Test pushed items count once in multiset mode.
+func (s *MySuite) TestPushMultiset(c *C) {
+	spq := NewMultisetSPQ()
+
+	h, _ := spq.Push("hello", 1)
+	spq.Update(h, 1)
+	spq.Push("hello", 1)
+
+	c.Assert(spq.length, Equals, uint(2))
+	c.Assert(spq.Remove(h), Equals, true)
+	c.Assert(spq.length, Equals, uint(1))
+	c.Assert(spq.Validate(), IsNil)
+}
@@ -0,0 +1,78 @@
+package go_shuffled_queue
+
+// Adds a payload to the priority queue identified by a key instead of by its value,
+// so that equal payloads or payloads that cannot be hashed, such as slices, can be queued.
+// If the key is already in the queue its payload and priority are replaced.
+// Returns ErrClosed if the queue is closed, ErrUnhashable if the key cannot be stored
+// or ErrFull if the queue is at capacity.
+func (spq *ShuffledPriorityQueue) AddKeyed(key, payload interface{}, priority int) error {
+	defer spq.checkInvariants("AddKeyed")
+
+	if spq.closed {
+		return ErrClosed
+	}
+
+	ref := keyRef{key}
+
+	if p, err := spq.TryFindPriority(ref); err == ErrUnhashable {
+		return err
+	} else if err == nil && p != priority {
+		spq.remove(ref, p)
+	}
+
+	return spq.put(ref, payload, priority)
+}
+
+// Removes the item with the key from the queue if exists.
+// Returns true if item was removed or false if the key was not found.
+func (spq *ShuffledPriorityQueue) RemoveKey(key interface{}) bool {
+	return spq.TryRemove(keyRef{key}) == nil
+}
+
+// Returns the payload of the item with the key.
+// Returns true if found otherwise false.
+func (spq *ShuffledPriorityQueue) GetKey(key interface{}) (interface{}, bool) {
+	priority, found := spq.FindPriorityKey(key)
+
+	if !found {
+		return nil, false
+	}
+
+	return spq.priorities[priority].value(keyRef{key}), true
+}
+
+// Returns the priority of the item with the key.
+// Returns true if found otherwise false.
+func (spq *ShuffledPriorityQueue) FindPriorityKey(key interface{}) (int, bool) {
+	return spq.FindPriority(keyRef{key})
+}
+
+// Removes the highest priority item from the queue and returns its key and payload.
+// Items added without a key are returned as both key and payload.
+// Returns true if found otherwise false.
+func (spq *ShuffledPriorityQueue) PopKeyed() (interface{}, interface{}, bool) {
+	defer spq.checkInvariants("PopKeyed")
+
+	priority, ok := spq.allowedKey(0, len(spq.keys), true)
+	if !ok {
+		return nil, nil, false
+	}
+
+	key, payload := spq.take(priority)
+	return key, payload, true
+}
+
+// Removes the lowest priority item from the queue and returns its key and payload.
+// Items added without a key are returned as both key and payload.
+// Returns true if found otherwise false.
+func (spq *ShuffledPriorityQueue) ShiftKeyed() (interface{}, interface{}, bool) {
+	defer spq.checkInvariants("ShiftKeyed")
+
+	priority, ok := spq.allowedKey(0, len(spq.keys), false)
+	if !ok {
+		return nil, nil, false
+	}
+
+	key, payload := spq.take(priority)
+	return key, payload, true
+}
@@ -0,0 +1,139 @@
+package go_shuffled_queue
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type job struct {
+	name string
+	args []string
+}
+
+// Test AddKeyed queues equal and unhashable payloads under different keys.
+func (s *MySuite) TestAddKeyed(c *C) {
+	spq := NewSPQ()
+
+	c.Assert(spq.AddKeyed(1, job{"build", []string{"-v"}}, 1), IsNil)
+	c.Assert(spq.AddKeyed(2, job{"build", []string{"-v"}}, 1), IsNil)
+	c.Assert(spq.AddKeyed(3, []int{1, 2}, 2), IsNil)
+	c.Assert(spq.length, Equals, uint(3))
+
+	payload, ok := spq.GetKey(3)
+	c.Assert(ok, Equals, true)
+	c.Assert(payload, DeepEquals, []int{1, 2})
+}
+
+// Test AddKeyed replaces the payload and priority of a key already queued.
+func (s *MySuite) TestAddKeyedReplaces(c *C) {
+	spq := NewSPQ()
+
+	spq.AddKeyed("job", "first", 1)
+	spq.AddKeyed("job", "second", 1)
+
+	payload, _ := spq.GetKey("job")
+	c.Assert(payload, Equals, "second")
+	c.Assert(spq.length, Equals, uint(1))
+
+	spq.AddKeyed("job", "third", 5)
+
+	priority, found := spq.FindPriorityKey("job")
+	c.Assert(found, Equals, true)
+	c.Assert(priority, Equals, 5)
+	c.Assert(spq.keys, DeepEquals, []int{5})
+	c.Assert(spq.length, Equals, uint(1))
+}
+
+// Test AddKeyed rejects unhashable keys.
+func (s *MySuite) TestAddKeyedUnhashable(c *C) {
+	spq := NewSPQ()
+
+	c.Assert(spq.AddKeyed([]int{1}, "hello", 1), Equals, ErrUnhashable)
+	c.Assert(spq.length, Equals, uint(0))
+}
+
+// Test keys do not collide with items added without a key.
+func (s *MySuite) TestKeyedDoesNotCollide(c *C) {
+	spq := NewSPQ()
+
+	spq.AddPriority("hello", 1)
+	spq.AddKeyed("hello", "world", 1)
+
+	c.Assert(spq.length, Equals, uint(2))
+	c.Assert(spq.RemoveKey("hello"), Equals, true)
+	c.Assert(spq.RemoveKey("hello"), Equals, false)
+
+	priority, found := spq.FindPriority("hello")
+	c.Assert(found, Equals, true)
+	c.Assert(priority, Equals, 1)
+}
+
+// Test PopKeyed and ShiftKeyed return both key and payload.
+func (s *MySuite) TestPopAndShiftKeyed(c *C) {
+	spq := NewSPQ()
+
+	spq.AddKeyed("low", []string{"a"}, 0)
+	spq.AddKeyed("high", []string{"b"}, 2)
+	spq.AddPriority("plain", 1)
+
+	key, payload, ok := spq.PopKeyed()
+	c.Assert(ok, Equals, true)
+	c.Assert(key, Equals, "high")
+	c.Assert(payload, DeepEquals, []string{"b"})
+
+	key, payload, ok = spq.ShiftKeyed()
+	c.Assert(ok, Equals, true)
+	c.Assert(key, Equals, "low")
+	c.Assert(payload, DeepEquals, []string{"a"})
+
+	key, payload, ok = spq.PopKeyed()
+	c.Assert(ok, Equals, true)
+	c.Assert(key, Equals, "plain")
+	c.Assert(payload, Equals, "plain")
+
+	_, _, ok = spq.ShiftKeyed()
+	c.Assert(ok, Equals, false)
+
+	_, found := spq.GetKey("low")
+	c.Assert(found, Equals, false)
+}
+
+// Test Pop and Last return the payload of keyed items.
+func (s *MySuite) TestPopReturnsPayload(c *C) {
+	spq := NewSPQ()
+	spq.AddKeyed(1, "hello", 1)
+
+	item, _ := spq.Last()
+	c.Assert(item, Equals, "hello")
+	c.Assert(spq.PeekBucket(1), DeepEquals, []interface{}{"hello"})
+
+	item, _ = spq.Pop()
+	c.Assert(item, Equals, "hello")
+	c.Assert(spq.Validate(), IsNil)
+}
+
+// Test payloads follow keyed items through snapshots, clones and set algebra.
+func (s *MySuite) TestKeyedCopies(c *C) {
+	spq := NewSPQ()
+	spq.AddKeyed(1, "hello", 1)
+
+	snapshot := spq.Snapshot()
+	spq.AddKeyed(1, "world", 1)
+
+	payload, _ := snapshot.GetKey(1)
+	c.Assert(payload, Equals, "hello")
+
+	payload, _ = spq.Clone().GetKey(1)
+	c.Assert(payload, Equals, "world")
+
+	payload, _ = spq.Union(NewSPQ()).GetKey(1)
+	c.Assert(payload, Equals, "world")
+
+	high, _ := spq.Split(func(v interface{}, priority int) bool {
+		return v == "world"
+	})
+	payload, _ = high.GetKey(1)
+	c.Assert(payload, Equals, "world")
+
+	c.Assert(snapshot.Validate(), IsNil)
+	c.Assert(spq.Validate(), IsNil)
+}
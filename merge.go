@@ -0,0 +1,337 @@
+package go_shuffled_queue
+
+import (
+	"errors"
+	"sort"
+
+	"deckarep/golang-set"
+)
+
+// A ConflictPolicy decides the priority of an item that Merge finds in both queues at different priorities.
+type ConflictPolicy int
+
+const (
+	// Keep the item with the highest of the two priorities.
+	KeepMax ConflictPolicy = iota
+	// Keep the item with the lowest of the two priorities.
+	KeepMin
+	// Keep the item with the sum of the two priorities.
+	SumPriorities
+	// Abort the merge with ErrMergeConflict.
+	ErrorOnConflict
+)
+
+// Returned by Merge when an item exists in both queues at different priorities and the policy is ErrorOnConflict.
+var ErrMergeConflict = errors.New("shuffled queue: item exists in both queues with different priorities")
+
+// Adds all the items of the other queue to the queue. The other queue is not mutated.
+// When an item already exists in the queue at a different priority the policy decides its new priority.
+// Conflicts are resolved against the queue as it was before the merge, so an item the other queue holds
+// at several priorities is added at each of them and an item of the queue may be moved to several priorities.
+// Added items keep their metadata, such as their attempts and tags, and moved items keep the one they had.
+// In multiset mode added items keep their number of occurrences and moved items take all of theirs along.
+// The queue is left untouched and ErrMergeConflict is returned if the policy is ErrorOnConflict and an item
+// conflicts, ErrClosed if the queue is closed or ErrFull if the items added would exceed its capacity.
+func (spq *ShuffledPriorityQueue) Merge(other *ShuffledPriorityQueue, policy ConflictPolicy) error {
+	defer spq.checkInvariants("Merge")
+
+	if spq.closed {
+		return ErrClosed
+	}
+
+	// Work out where every item goes before mutating anything
+	var moves []mergeMove
+	moved := map[mergeKey]int{}
+
+	for _, priority := range other.keys {
+		b := other.priorities[priority]
+
+		for _, item := range b.items() {
+			if spq.contains(item, priority) {
+				continue
+			}
+
+			move := mergeMove{item: item, payload: b.value(item), target: priority, meta: b.meta[item], count: 1}
+
+			if spq.multiset {
+				move.count = b.count(item)
+			}
+
+			if p, found := spq.FindPriority(item); found {
+				target, err := resolveConflict(policy, p, priority)
+				if err != nil {
+					return err
+				}
+
+				move.target, move.meta, move.count = target, spq.priorities[p].meta[item], spq.priorities[p].count(item)
+				moved[mergeKey{item, p}] = move.count
+			}
+
+			moves = append(moves, move)
+		}
+	}
+
+	// Count the items added, an item the queue holds at a target priority it is not moved from is left alone
+	added := 0
+	placed := map[mergeKey]bool{}
+
+	for _, move := range moves {
+		k := mergeKey{move.item, move.target}
+
+		if _, ok := moved[k]; placed[k] || (spq.contains(move.item, move.target) && !ok) {
+			continue
+		}
+
+		placed[k] = true
+		added += move.count
+	}
+
+	for _, count := range moved {
+		added -= count
+	}
+
+	if spq.capacity > 0 && int(spq.length)+added > int(spq.capacity) {
+		return ErrFull
+	}
+
+	for k, count := range moved {
+		for i := 0; i < count; i += 1 {
+			spq.remove(k.item, k.priority)
+		}
+	}
+
+	for _, move := range moves {
+		if spq.contains(move.item, move.target) {
+			continue
+		}
+
+		if err := spq.putMeta(move.item, move.payload, move.target, move.meta, move.count); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// An item of a queue at a priority.
+type mergeKey struct {
+	item     interface{}
+	priority int
+}
+
+// Where Merge puts an item of the other queue, with the metadata and the number of occurrences it keeps.
+type mergeMove struct {
+	item    interface{}
+	payload interface{}
+	target  int
+	meta    metadata
+	count   int
+}
+
+// Returns two new queues: the first with the items matching the predicate and the second with the rest.
+// The predicate is given the payload of keyed items. Items keep their metadata, such as their attempts and tags.
+// Both queues use copies of the tie breakers of the queue.
+// The queue is not mutated.
+func (spq *ShuffledPriorityQueue) Split(predicate func(v interface{}, priority int) bool) (*ShuffledPriorityQueue, *ShuffledPriorityQueue) {
+	matching, rest := spq.emptyCopy(), spq.emptyCopy()
+
+	for _, priority := range spq.keys {
+		b := spq.priorities[priority]
+
+		for _, item := range b.items() {
+			q := rest
+			if predicate(b.value(item), priority) {
+				q = matching
+			}
+
+			q.putMeta(item, b.value(item), priority, b.meta[item], b.count(item))
+		}
+	}
+
+	return matching, rest
+}
+
+// Returns a new queue with the items that are in either queue with the same priority.
+// A key is only ever at one priority: keyed items of the other queue whose key the queue holds
+// at another priority are left out.
+func (spq *ShuffledPriorityQueue) Union(other *ShuffledPriorityQueue) *ShuffledPriorityQueue {
+	union := spq.emptyCopy()
+	keyed := spq.keyedPriorities()
+
+	for priority, b := range spq.priorities {
+		o, ok := other.priorities[priority]
+
+		if !ok {
+			union.setBucket(priority, bucketFromSet(b.Set, b))
+			continue
+		}
+
+		union.setBucket(priority, bucketFromSet(b.Set.Union(withoutKeys(o, priority, keyed)), b, o))
+	}
+
+	for priority, o := range other.priorities {
+		if _, ok := spq.priorities[priority]; !ok {
+			union.setBucket(priority, bucketFromSet(withoutKeys(o, priority, keyed), o))
+		}
+	}
+
+	return union
+}
+
+// Returns the priority of every key of the queue.
+func (spq *ShuffledPriorityQueue) keyedPriorities() map[interface{}]int {
+	keyed := map[interface{}]int{}
+
+	for priority, b := range spq.priorities {
+		for key := range b.payloads {
+			keyed[key] = priority
+		}
+	}
+
+	return keyed
+}
+
+// Returns the set of the bucket of the specified priority without the keyed items whose key is at another priority.
+func withoutKeys(b *bucket, priority int, keyed map[interface{}]int) mapset.Set {
+	set := b.Set
+
+	for key := range b.payloads {
+		if p, ok := keyed[key]; ok && p != priority {
+			if set == b.Set {
+				set = b.Set.Clone()
+			}
+			set.Remove(keyRef{key})
+		}
+	}
+
+	return set
+}
+
+// Returns a new queue with the items that are in both queues with the same priority.
+func (spq *ShuffledPriorityQueue) Intersect(other *ShuffledPriorityQueue) *ShuffledPriorityQueue {
+	intersection := spq.emptyCopy()
+
+	for priority, b := range spq.priorities {
+		if o, ok := other.priorities[priority]; ok {
+			intersection.setBucket(priority, bucketFromSet(b.Set.Intersect(o.Set), b))
+		}
+	}
+
+	return intersection
+}
+
+// Returns a new queue with the items of the queue that are not in the other queue with the same priority.
+func (spq *ShuffledPriorityQueue) Difference(other *ShuffledPriorityQueue) *ShuffledPriorityQueue {
+	difference := spq.emptyCopy()
+
+	for priority, b := range spq.priorities {
+		if o, ok := other.priorities[priority]; ok {
+			difference.setBucket(priority, bucketFromSet(b.Set.Difference(o.Set), b))
+		} else {
+			difference.setBucket(priority, bucketFromSet(b.Set, b))
+		}
+	}
+
+	return difference
+}
+
+// Returns true if the item exists with the specified priority.
+func (spq *ShuffledPriorityQueue) contains(v interface{}, priority int) bool {
+	b, ok := spq.priorities[priority]
+
+	return ok && b.Contains(v)
+}
+
+// Returns an empty queue using copies of the tie breakers and the sampler of the queue,
+// so that picking from either queue leaves the choices of the other unchanged.
+func (spq *ShuffledPriorityQueue) emptyCopy() *ShuffledPriorityQueue {
+	q := NewSPQ()
+	q.tieBreaker = cloneTieBreaker(spq.tieBreaker)
+	q.multiset = spq.multiset
+	q.clock = spq.clock
+	q.sampler = spq.sampler.clone()
+
+	for priority, tb := range spq.tieBreakers {
+		q.tieBreakers[priority] = cloneTieBreaker(tb)
+	}
+
+	return q
+}
+
+// Adds count occurrences of an item with its payload and metadata to the bucket of the specified priority.
+// The metadata is only set if the item was not in the bucket yet.
+func (spq *ShuffledPriorityQueue) putMeta(v interface{}, payload interface{}, priority int, m metadata, count int) error {
+	exists := spq.contains(v, priority)
+
+	if err := spq.put(v, payload, priority); err != nil {
+		return err
+	}
+
+	if !exists {
+		m.tags = copyTags(m.tags)
+		spq.priorities[priority].meta[v] = m
+	}
+
+	for i := 1; i < count; i += 1 {
+		if err := spq.put(v, payload, priority); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Stores the bucket for a priority that has no bucket yet. Empty buckets are dropped.
+func (spq *ShuffledPriorityQueue) setBucket(priority int, b *bucket) {
+	if b.Cardinality() == 0 {
+		return
+	}
+
+	spq.priorities[priority] = b
+	spq.keys = append(spq.keys, priority)
+	spq.length += uint(b.size)
+
+	sort.Ints(spq.keys)
+}
+
+// Returns a new bucket with the items of the buckets that are members of the set, keeping their insertion order.
+// Items occurring more than once keep the count of the first bucket holding them.
+func bucketFromSet(set mapset.Set, buckets ...*bucket) *bucket {
+	nb := newBucket()
+
+	for _, b := range buckets {
+		for _, v := range b.items() {
+			if set.Contains(v) && !nb.Contains(v) {
+				nb.put(v, b.value(v))
+				nb.meta[v] = b.meta[v]
+
+				for i := b.count(v); i > 1; i -= 1 {
+					nb.increment(v)
+				}
+			}
+		}
+	}
+
+	return nb
+}
+
+// Returns the priority of an item found at priorities a and b according to the policy.
+// Returns ErrMergeConflict if the policy is ErrorOnConflict.
+func resolveConflict(policy ConflictPolicy, a, b int) (int, error) {
+	switch policy {
+	case KeepMin:
+		if a < b {
+			return a, nil
+		}
+		return b, nil
+	case SumPriorities:
+		return a + b, nil
+	case ErrorOnConflict:
+		return 0, ErrMergeConflict
+	default:
+		if a > b {
+			return a, nil
+		}
+		return b, nil
+	}
+}
@@ -0,0 +1,258 @@
+package go_shuffled_queue
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func newSPQWith(items map[string]int) *ShuffledPriorityQueue {
+	spq := NewSPQ()
+
+	for item, priority := range items {
+		spq.AddPriority(item, priority)
+	}
+
+	return spq
+}
+
+// Test Merge adds the items of the other queue without mutating it.
+func (s *MySuite) TestMerge(c *C) {
+	spq := newSPQWith(map[string]int{"hello": 1, "world": 2})
+	other := newSPQWith(map[string]int{"welt": 3, "world": 2})
+
+	c.Assert(spq.Merge(other, ErrorOnConflict), IsNil)
+	c.Assert(spq.length, Equals, uint(3))
+	c.Assert(spq.keys, DeepEquals, []int{1, 2, 3})
+	c.Assert(other.length, Equals, uint(2))
+}
+
+// Test Merge resolves items existing in both queues at different priorities using the policy.
+func (s *MySuite) TestMergeConflictPolicies(c *C) {
+	expected := map[ConflictPolicy]int{KeepMax: 5, KeepMin: 2, SumPriorities: 7}
+
+	for policy, priority := range expected {
+		spq := newSPQWith(map[string]int{"hello": 2, "world": 0})
+		other := newSPQWith(map[string]int{"hello": 5})
+
+		c.Assert(spq.Merge(other, policy), IsNil)
+
+		p, found := spq.FindPriority("hello")
+		c.Assert(found, Equals, true)
+		c.Assert(p, Equals, priority)
+		c.Assert(spq.length, Equals, uint(2))
+	}
+}
+
+// Test Merge with ErrorOnConflict leaves the queue untouched on conflicts.
+func (s *MySuite) TestMergeErrorOnConflict(c *C) {
+	spq := newSPQWith(map[string]int{"hello": 2})
+	other := newSPQWith(map[string]int{"welt": 1, "hello": 5})
+
+	c.Assert(spq.Merge(other, ErrorOnConflict), Equals, ErrMergeConflict)
+	c.Assert(spq.length, Equals, uint(1))
+
+	_, found := spq.FindPriority("welt")
+	c.Assert(found, Equals, false)
+}
+
+// Test Merge adds an item the other queue holds at several priorities at each of them.
+func (s *MySuite) TestMergeItemAtSeveralPriorities(c *C) {
+	for _, policy := range []ConflictPolicy{KeepMax, KeepMin, SumPriorities, ErrorOnConflict} {
+		spq := NewSPQ()
+		other := NewSPQ()
+		other.AddPriority("hello", 1)
+		other.AddPriority("hello", 5)
+
+		c.Assert(spq.Merge(other, policy), IsNil)
+		c.Assert(spq.keys, DeepEquals, []int{1, 5})
+		c.Assert(spq.length, Equals, uint(2))
+	}
+}
+
+// Test Merge resolves every priority of an item the other queue holds at several priorities
+// against the priority the item had before the merge.
+func (s *MySuite) TestMergeConflictsAtSeveralPriorities(c *C) {
+	expected := map[ConflictPolicy][]int{KeepMax: {3, 5}, KeepMin: {1, 3}, SumPriorities: {4, 8}}
+
+	for policy, priorities := range expected {
+		spq := newSPQWith(map[string]int{"hello": 3})
+		other := NewSPQ()
+		other.AddPriority("hello", 1)
+		other.AddPriority("hello", 5)
+
+		c.Assert(spq.Merge(other, policy), IsNil)
+		c.Assert(spq.keys, DeepEquals, priorities)
+		c.Assert(spq.length, Equals, uint(2))
+	}
+
+	spq := newSPQWith(map[string]int{"hello": 3})
+	other := NewSPQ()
+	other.AddPriority("hello", 3)
+	other.AddPriority("hello", 5)
+
+	c.Assert(spq.Merge(other, ErrorOnConflict), Equals, ErrMergeConflict)
+	c.Assert(spq.keys, DeepEquals, []int{3})
+}
+
+// Test Merge leaves a closed queue or a queue without room for the items untouched.
+func (s *MySuite) TestMergeClosedOrFull(c *C) {
+	spq := newSPQWith(map[string]int{"hello": 2})
+	other := newSPQWith(map[string]int{"hello": 5, "welt": 1})
+
+	spq.SetCapacity(1)
+	c.Assert(spq.Merge(other, KeepMax), Equals, ErrFull)
+	c.Assert(spq.length, Equals, uint(1))
+	c.Assert(spq.Count("hello"), Equals, 1)
+
+	spq.SetCapacity(2)
+	spq.Close()
+	c.Assert(spq.Merge(other, KeepMax), Equals, ErrClosed)
+	p, found := spq.FindPriority("hello")
+	c.Assert(found, Equals, true)
+	c.Assert(p, Equals, 2)
+}
+
+// Test Merge carries the metadata of added items over and moved items keep their own.
+func (s *MySuite) TestMergeMetadata(c *C) {
+	spq := NewSPQ()
+	c.Assert(spq.AddEnvelope(&Envelope{Value: "hello", Priority: 2, Attempts: 4}), IsNil)
+
+	other := NewSPQ()
+	c.Assert(other.AddEnvelope(&Envelope{Value: "hello", Priority: 5, Attempts: 1}), IsNil)
+	c.Assert(other.AddEnvelope(&Envelope{Value: "welt", Priority: 1, Attempts: 2, Tags: map[string]string{"a": "b"}}), IsNil)
+
+	c.Assert(spq.Merge(other, KeepMax), IsNil)
+
+	env, _ := spq.PopEnvelope()
+	c.Assert(env.Value, Equals, "hello")
+	c.Assert(env.Attempts, Equals, 5)
+
+	env, _ = spq.PopEnvelope()
+	c.Assert(env.Value, Equals, "welt")
+	c.Assert(env.Attempts, Equals, 3)
+	c.Assert(env.Tags, DeepEquals, map[string]string{"a": "b"})
+}
+
+// Test Split partitions the items using the predicate without mutating the queue.
+func (s *MySuite) TestSplit(c *C) {
+	spq := newSPQWith(map[string]int{"hello": 1, "world": 2, "welt": 3, "verden": 4})
+
+	high, low := spq.Split(func(v interface{}, priority int) bool {
+		return priority > 2
+	})
+
+	c.Assert(high.keys, DeepEquals, []int{3, 4})
+	c.Assert(high.length, Equals, uint(2))
+	c.Assert(low.keys, DeepEquals, []int{1, 2})
+	c.Assert(low.length, Equals, uint(2))
+	c.Assert(spq.length, Equals, uint(4))
+}
+
+// Test Split carries the metadata of the items over.
+func (s *MySuite) TestSplitMetadata(c *C) {
+	clock := newManualClock()
+	spq := NewSPQ()
+	spq.SetClock(clock)
+	c.Assert(spq.AddEnvelope(&Envelope{Value: "hello", Priority: 2, Attempts: 4}), IsNil)
+	c.Assert(spq.AddEnvelope(&Envelope{Value: "welt", Priority: 1, Attempts: 2, Tags: map[string]string{"a": "b"}}), IsNil)
+	enqueued := clock.Now()
+	clock.Advance(time.Minute)
+
+	high, low := spq.Split(func(v interface{}, priority int) bool {
+		return priority > 1
+	})
+
+	env, _ := high.PopEnvelope()
+	c.Assert(env.Value, Equals, "hello")
+	c.Assert(env.Attempts, Equals, 5)
+	c.Assert(env.Enqueued.Equal(enqueued), Equals, true)
+
+	env, _ = low.PopEnvelope()
+	c.Assert(env.Value, Equals, "welt")
+	c.Assert(env.Attempts, Equals, 3)
+	c.Assert(env.Tags, DeepEquals, map[string]string{"a": "b"})
+}
+
+// Test the queues returned by Split pick with their own tie breaker state.
+func (s *MySuite) TestSplitTieBreakerState(c *C) {
+	spq := NewSPQ()
+	spq.SetTieBreaker(NewRoundRobinTieBreaker())
+	spq.AddPriority("hello", 1)
+	spq.AddPriority("world", 1)
+	spq.AddPriority("welt", 1)
+
+	matching, _ := spq.Split(func(v interface{}, priority int) bool {
+		return true
+	})
+
+	for _, expected := range []string{"hello", "world"} {
+		item, _ := matching.Last()
+		c.Assert(item, Equals, expected)
+	}
+
+	item, _ := spq.Last()
+	c.Assert(item, Equals, "hello")
+}
+
+// Test Union, Intersect and Difference compare items by priority.
+func (s *MySuite) TestSetAlgebra(c *C) {
+	a := newSPQWith(map[string]int{"hello": 1, "world": 2, "welt": 3})
+	b := newSPQWith(map[string]int{"hello": 1, "world": 5, "verden": 3})
+
+	union := a.Union(b)
+	c.Assert(union.length, Equals, uint(5))
+	c.Assert(union.keys, DeepEquals, []int{1, 2, 3, 5})
+	c.Assert(union.PeekBucket(3), DeepEquals, []interface{}{"welt", "verden"})
+
+	intersection := a.Intersect(b)
+	c.Assert(intersection.length, Equals, uint(1))
+	c.Assert(intersection.keys, DeepEquals, []int{1})
+
+	difference := a.Difference(b)
+	c.Assert(difference.length, Equals, uint(2))
+	c.Assert(difference.keys, DeepEquals, []int{2, 3})
+
+	c.Assert(a.length, Equals, uint(3))
+	c.Assert(b.length, Equals, uint(3))
+}
+
+// Test Union keeps a key at the priority the queue holds it at.
+func (s *MySuite) TestUnionKeyed(c *C) {
+	a := NewSPQ()
+	c.Assert(a.AddKeyed("key", "hello", 1), IsNil)
+	c.Assert(a.AddKeyed("other", "world", 2), IsNil)
+	b := NewSPQ()
+	c.Assert(b.AddKeyed("key", "welt", 2), IsNil)
+	c.Assert(b.AddKeyed("other", "verden", 2), IsNil)
+	c.Assert(b.AddKeyed("more", "mundo", 3), IsNil)
+
+	union := a.Union(b)
+	c.Assert(union.Validate(), IsNil)
+	c.Assert(union.length, Equals, uint(3))
+
+	p, _ := union.FindPriorityKey("key")
+	c.Assert(p, Equals, 1)
+	payload, _ := union.GetKey("key")
+	c.Assert(payload, Equals, "hello")
+
+	c.Assert(union.RemoveKey("key"), Equals, true)
+	_, found := union.FindPriorityKey("key")
+	c.Assert(found, Equals, false)
+
+	// The other queue alone may hold the key
+	union = NewSPQ().Union(b)
+	p, _ = union.FindPriorityKey("key")
+	c.Assert(p, Equals, 2)
+}
+
+// Test queues built from set algebra do not share buckets with their operands.
+func (s *MySuite) TestSetAlgebraDoesNotShareBuckets(c *C) {
+	a := newSPQWith(map[string]int{"hello": 1})
+	b := NewSPQ()
+
+	union := a.Union(b)
+	union.AddPriority("world", 1)
+
+	c.Assert(a.PeekBucket(1), DeepEquals, []interface{}{"hello"})
+}
@@ -0,0 +1,154 @@
+package go_shuffled_queue
+
+import (
+	"math/rand"
+
+	"github.com/theodesp/go-shuffled-queue/fairness"
+	. "gopkg.in/check.v1"
+)
+
+// Test adding an item again in multiset mode adds one more occurrence.
+func (s *MySuite) TestMultisetAdd(c *C) {
+	spq := NewMultisetSPQ()
+
+	spq.AddPriority("alice", 1)
+	spq.AddPriority("alice", 1)
+	spq.AddPriority("alice", 2)
+	spq.AddPriority("bob", 1)
+
+	c.Assert(spq.length, Equals, uint(4))
+	c.Assert(spq.Count("alice"), Equals, 3)
+	c.Assert(spq.Count("bob"), Equals, 1)
+	c.Assert(spq.Count("carol"), Equals, 0)
+	c.Assert(spq.CountRange(1, 1), Equals, 3)
+	c.Assert(spq.PeekBucket(1), DeepEquals, []interface{}{"alice", "alice", "bob"})
+	c.Assert(spq.Validate(), IsNil)
+}
+
+// Test adding an item again outside of multiset mode still does nothing.
+func (s *MySuite) TestCountWithoutMultiset(c *C) {
+	spq := NewSPQ()
+
+	spq.AddPriority("alice", 1)
+	spq.AddPriority("alice", 1)
+	spq.AddPriority("alice", 2)
+
+	c.Assert(spq.Count("alice"), Equals, 2)
+	c.Assert(spq.Count([]int{1}), Equals, 0)
+}
+
+// Test removing and popping in multiset mode removes a single occurrence.
+func (s *MySuite) TestMultisetRemove(c *C) {
+	spq := NewMultisetSPQ()
+
+	spq.AddPriority("alice", 1)
+	spq.AddPriority("alice", 1)
+	spq.AddPriority("alice", 1)
+
+	c.Assert(spq.Remove("alice"), Equals, true)
+	c.Assert(spq.Count("alice"), Equals, 2)
+
+	item, ok := spq.Pop()
+	c.Assert(ok, Equals, true)
+	c.Assert(item, Equals, "alice")
+	c.Assert(spq.length, Equals, uint(1))
+
+	spq.Pop()
+	c.Assert(spq.length, Equals, uint(0))
+	c.Assert(spq.keys, DeepEquals, []int{})
+	c.Assert(spq.Validate(), IsNil)
+}
+
+// Test capacity counts every occurrence in multiset mode.
+func (s *MySuite) TestMultisetCapacity(c *C) {
+	spq := NewMultisetSPQ()
+	spq.SetCapacity(2)
+
+	c.Assert(spq.TryAdd("alice"), IsNil)
+	c.Assert(spq.TryAdd("alice"), IsNil)
+	c.Assert(spq.TryAdd("alice"), Equals, ErrFull)
+	c.Assert(spq.RemoveRange(0, 0), Equals, 2)
+	c.Assert(spq.length, Equals, uint(0))
+}
+
+// Test occurrences survive snapshots and clones.
+func (s *MySuite) TestMultisetCopies(c *C) {
+	spq := NewMultisetSPQ()
+	spq.Add("alice")
+	spq.Add("alice")
+
+	snapshot := spq.Snapshot()
+	spq.Add("alice")
+
+	c.Assert(snapshot.Count("alice"), Equals, 2)
+	c.Assert(spq.Clone().Count("alice"), Equals, 3)
+	c.Assert(spq.Union(NewSPQ()).Count("alice"), Equals, 3)
+
+	snapshot.Add("alice")
+	c.Assert(snapshot.Count("alice"), Equals, 3)
+	c.Assert(spq.Validate(), IsNil)
+	c.Assert(snapshot.Validate(), IsNil)
+}
+
+// Test Merge and Split carry every occurrence over.
+func (s *MySuite) TestMultisetMergeSplit(c *C) {
+	spq := NewMultisetSPQ()
+	spq.AddPriority("alice", 1)
+	spq.AddPriority("alice", 1)
+	spq.AddPriority("bob", 1)
+
+	matching, rest := spq.Split(func(v interface{}, priority int) bool {
+		return v == "alice"
+	})
+	c.Assert(matching.Count("alice"), Equals, 2)
+	c.Assert(matching.Len(), Equals, 2)
+	c.Assert(rest.Len(), Equals, 1)
+
+	other := NewMultisetSPQ()
+	other.AddPriority("carol", 2)
+	other.AddPriority("carol", 2)
+	other.AddPriority("carol", 2)
+
+	merged := NewMultisetSPQ()
+	c.Assert(merged.Merge(other, KeepMax), IsNil)
+	c.Assert(merged.Count("carol"), Equals, 3)
+	c.Assert(merged.Len(), Equals, 3)
+
+	// Moved items take all their occurrences along
+	c.Assert(spq.Merge(newSPQWith(map[string]int{"alice": 5}), KeepMax), IsNil)
+	p, _ := spq.FindPriority("alice")
+	c.Assert(p, Equals, 5)
+	c.Assert(spq.Count("alice"), Equals, 2)
+	c.Assert(spq.Len(), Equals, 3)
+	c.Assert(spq.Validate(), IsNil)
+
+	// The capacity counts every occurrence added
+	merged = NewMultisetSPQ()
+	merged.SetCapacity(2)
+	c.Assert(merged.Merge(other, KeepMax), Equals, ErrFull)
+	c.Assert(merged.Len(), Equals, 0)
+}
+
+// Test items are picked proportionally to how many times they occur.
+func (s *MySuite) TestMultisetWeightedPicks(c *C) {
+	spq := NewMultisetSPQ()
+	spq.SetTieBreaker(NewRandomTieBreaker(rand.NewSource(5)))
+
+	tickets := map[string]int{"alice": 1, "bob": 2, "carol": 5}
+	for user, count := range tickets {
+		for i := 0; i < count; i += 1 {
+			spq.Add(user)
+		}
+	}
+
+	counts := map[interface{}]int{}
+	for i := 0; i < 8000; i += 1 {
+		item, _ := spq.Last()
+		counts[item] += 1
+	}
+
+	_, pValue := fairness.ChiSquareExpected(
+		[]int{counts["alice"], counts["bob"], counts["carol"]},
+		[]float64{1000, 2000, 5000})
+	c.Assert(pValue >= fairness.DefaultAlpha, Equals, true)
+}
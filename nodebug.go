@@ -0,0 +1,6 @@
+//go:build !spqdebug
+
+package go_shuffled_queue
+
+// Does nothing unless built with the spqdebug build tag.
+func (spq *ShuffledPriorityQueue) checkInvariants(op string) {}
@@ -0,0 +1,227 @@
+package go_shuffled_queue
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// An Item is a value with its priority as it goes in and out of the queue through channels.
+type Item struct {
+	Value    interface{}
+	Priority int
+
+	// The envelope the item was taken out of the queue with, to put it back if it is never received.
+	env *Envelope
+}
+
+// Lets Feed and Stream share the queue between goroutines.
+// A signal channel is closed and replaced to wake up every goroutine waiting on it.
+type pipe struct {
+	mu     sync.Mutex
+	added  chan struct{}
+	taken  chan struct{}
+	buffer int
+}
+
+func newPipe() *pipe {
+	return &pipe{
+		added: make(chan struct{}),
+		taken: make(chan struct{})}
+}
+
+// Wakes up the goroutines waiting on the signal. Must be called with the lock held.
+func (p *pipe) broadcast(signal *chan struct{}) {
+	close(*signal)
+	*signal = make(chan struct{})
+}
+
+// Sets the buffer size of the channels returned by Stream. Defaults to 0, an unbuffered channel.
+func (spq *ShuffledPriorityQueue) SetStreamBuffer(size int) {
+	spq.pipe.mu.Lock()
+	defer spq.pipe.mu.Unlock()
+
+	spq.pipe.buffer = size
+}
+
+// Adds the items arriving on the channel to the queue until the channel is closed or the context is done.
+// When the queue is at capacity Feed waits for room before receiving the next item.
+// Returns nil once the channel is closed, the context error once it is done or the error of an item that
+// could not be added, see TryAddPriority.
+// The queue is not thread safe: while Feed or Stream run other goroutines may only call Close.
+func (spq *ShuffledPriorityQueue) Feed(ctx context.Context, in <-chan Item) error {
+	for {
+		if err := spq.waitForRoom(ctx); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case item, ok := <-in:
+			if !ok {
+				return nil
+			}
+
+			if err := spq.feed(ctx, item); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Returns a channel emitting the items of the queue in Pop order as they become available.
+// Every item is handed off exactly once: once the context is done the items that were taken out of the queue
+// but not received, including the ones left in the channel buffer, are put back in the queue.
+// The channel is closed once the context is done or the queue is closed and empty.
+// The queue is not thread safe: while Feed or Stream run other goroutines may only call Close.
+func (spq *ShuffledPriorityQueue) Stream(ctx context.Context) <-chan Item {
+	spq.pipe.mu.Lock()
+	out := make(chan Item, spq.pipe.buffer)
+	spq.pipe.mu.Unlock()
+
+	go spq.stream(ctx, out)
+
+	return out
+}
+
+// Waits until the queue has room for one more item.
+func (spq *ShuffledPriorityQueue) waitForRoom(ctx context.Context) error {
+	for {
+		spq.pipe.mu.Lock()
+		full := spq.capacity > 0 && spq.length >= spq.capacity
+		taken := spq.pipe.taken
+		spq.pipe.mu.Unlock()
+
+		if !full {
+			return nil
+		}
+
+		select {
+		case <-taken:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Adds an item received by Feed, waiting for room if another goroutine filled the queue in the meantime.
+func (spq *ShuffledPriorityQueue) feed(ctx context.Context, item Item) error {
+	for {
+		spq.pipe.mu.Lock()
+		err := spq.TryAddPriority(item.Value, item.Priority)
+		if err == nil {
+			spq.pipe.broadcast(&spq.pipe.added)
+		}
+		taken := spq.pipe.taken
+		spq.pipe.mu.Unlock()
+
+		if err != ErrFull {
+			return err
+		}
+
+		select {
+		case <-taken:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Takes items out of the queue and sends them on the channel until the context is done
+// or the queue is closed and empty.
+func (spq *ShuffledPriorityQueue) stream(ctx context.Context, out chan Item) {
+	defer close(out)
+
+	for ctx.Err() == nil {
+		spq.pipe.mu.Lock()
+		env, ok := spq.PopEnvelope()
+		if ok {
+			spq.pipe.broadcast(&spq.pipe.taken)
+		}
+		closed := spq.closed && spq.length == 0
+		added := spq.pipe.added
+		var token <-chan time.Time
+		if !ok {
+			token = spq.nextToken()
+		}
+		spq.pipe.mu.Unlock()
+
+		if !ok {
+			if closed {
+				return
+			}
+
+			select {
+			case <-added:
+				continue
+			case <-token:
+				continue
+			case <-ctx.Done():
+				spq.unstream(out, nil)
+				return
+			}
+		}
+
+		select {
+		case out <- Item{Value: env.Value, Priority: env.Priority, env: env}:
+		case <-ctx.Done():
+			spq.unstream(out, env)
+			return
+		}
+	}
+
+	spq.unstream(out, nil)
+}
+
+// Puts back the item that could not be sent and the items left in the channel buffer.
+func (spq *ShuffledPriorityQueue) unstream(out chan Item, env *Envelope) {
+	spq.pipe.mu.Lock()
+	defer spq.pipe.mu.Unlock()
+
+	if env != nil {
+		spq.restore(env)
+	}
+
+	for {
+		select {
+		case item := <-out:
+			spq.restore(item.env)
+		default:
+			spq.pipe.broadcast(&spq.pipe.added)
+			return
+		}
+	}
+}
+
+// Puts back an item taken out of the queue as an envelope as if it was never taken,
+// even if the queue has been closed or filled since.
+func (spq *ShuffledPriorityQueue) restore(env *Envelope) {
+	spq.putBack(env, env.Attempts-1)
+}
+
+// Puts back an item taken out of the queue as an envelope with the envelope priority and the specified number
+// of attempts, even if the queue has been closed or filled since.
+func (spq *ShuffledPriorityQueue) putBack(env *Envelope, attempts int) {
+	defer spq.checkInvariants("putBack")
+
+	if spq.contains(env.item, env.Priority) {
+		if spq.multiset {
+			spq.writableBucket(env.Priority).increment(env.item)
+			spq.length += 1
+			spq.inserted(env.item, env.Priority)
+		}
+		return
+	}
+
+	if h, ok := env.item.(*Handle); ok {
+		h.queue = spq
+		h.priority = env.Priority
+	}
+
+	spq.insert(env.item, env.Value, env.Priority)
+	spq.priorities[env.Priority].meta[env.item] = metadata{
+		enqueued: env.Enqueued,
+		attempts: attempts,
+		tags:     env.Tags}
+}
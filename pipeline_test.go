@@ -0,0 +1,149 @@
+package go_shuffled_queue
+
+import (
+	"context"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+// Receives every item of the channel until it is closed.
+func receiveAll(out <-chan Item) []interface{} {
+	values := []interface{}{}
+
+	for item := range out {
+		values = append(values, item.Value)
+	}
+
+	return values
+}
+
+// Test Feed adds the items of the channel and Stream emits them in Pop order until the queue is closed and empty.
+func (s *MySuite) TestFeedStream(c *C) {
+	spq := NewSPQ()
+	spq.SetTieBreaker(NewFIFOTieBreaker())
+
+	in := make(chan Item, 3)
+	in <- Item{Value: "hello", Priority: 1}
+	in <- Item{Value: "world", Priority: 5}
+	in <- Item{Value: "welt", Priority: 1}
+	close(in)
+
+	c.Assert(spq.Feed(context.Background(), in), IsNil)
+	spq.Close()
+
+	c.Assert(receiveAll(spq.Stream(context.Background())), DeepEquals, []interface{}{"world", "hello", "welt"})
+	c.Assert(spq.length, Equals, uint(0))
+}
+
+// Test Stream waits for the items fed by another goroutine.
+func (s *MySuite) TestStreamWaits(c *C) {
+	spq := NewSPQ()
+	in := make(chan Item)
+	out := spq.Stream(context.Background())
+
+	go func() {
+		spq.Feed(context.Background(), in)
+		spq.Close()
+	}()
+
+	for i := 0; i < 100; i += 1 {
+		in <- Item{Value: i, Priority: i % 3}
+	}
+	close(in)
+
+	c.Assert(receiveAll(out), HasLen, 100)
+	c.Assert(spq.Validate(), IsNil)
+}
+
+// Test Stream puts back the item it could not hand off when the context is cancelled.
+func (s *MySuite) TestStreamCancelled(c *C) {
+	spq := NewSPQ()
+	spq.AddEnvelope(&Envelope{Value: "hello", Priority: 1, Attempts: 2})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := spq.Stream(ctx)
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	c.Assert(receiveAll(out), HasLen, 0)
+	c.Assert(spq.length, Equals, uint(1))
+
+	env, _ := spq.PopEnvelope()
+	c.Assert(env.Value, Equals, "hello")
+	c.Assert(env.Attempts, Equals, 3)
+}
+
+// Test Stream puts back the items left in the channel buffer when the context is cancelled.
+func (s *MySuite) TestStreamCancelledBuffered(c *C) {
+	spq := NewMultisetSPQ()
+	spq.SetStreamBuffer(2)
+
+	for _, v := range []string{"hello", "hello", "world", "welt"} {
+		spq.AddPriority(v, 1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := spq.Stream(ctx)
+
+	received := []interface{}{(<-out).Value}
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	received = append(received, receiveAll(out)...)
+
+	c.Assert(int(spq.length)+len(received), Equals, 4)
+
+	for _, v := range received {
+		spq.AddPriority(v, 1)
+	}
+	c.Assert(spq.Count("hello"), Equals, 2)
+	c.Assert(spq.length, Equals, uint(4))
+	c.Assert(spq.Validate(), IsNil)
+}
+
+// Test Feed waits for room in a queue at capacity.
+func (s *MySuite) TestFeedCapacity(c *C) {
+	spq := NewSPQ()
+	spq.SetCapacity(1)
+
+	in := make(chan Item)
+	fed := make(chan error)
+
+	go func() {
+		fed <- spq.Feed(context.Background(), in)
+	}()
+
+	in <- Item{Value: "hello"}
+
+	select {
+	case in <- Item{Value: "world"}:
+		c.Fatal("fed a full queue")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	out := spq.Stream(context.Background())
+	c.Assert((<-out).Value, Equals, "hello")
+
+	in <- Item{Value: "world"}
+	close(in)
+	c.Assert(<-fed, IsNil)
+	c.Assert((<-out).Value, Equals, "world")
+}
+
+// Test Feed stops on items that cannot be added and when the context is done.
+func (s *MySuite) TestFeedErrors(c *C) {
+	spq := NewSPQ()
+
+	in := make(chan Item, 1)
+	in <- Item{Value: []int{1}}
+	c.Assert(spq.Feed(context.Background(), in), Equals, ErrUnhashable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Assert(spq.Feed(ctx, in), Equals, context.Canceled)
+
+	spq.Close()
+	in <- Item{Value: "hello"}
+	c.Assert(spq.Feed(context.Background(), in), Equals, ErrClosed)
+}
@@ -0,0 +1,17 @@
+package go_shuffled_queue
+
+// A Queue is a priority queue that shuffles items with the same priority.
+// ShuffledPriorityQueue implements it in process, other implementations may be remote or persistent
+// so that they can be swapped with each other.
+type Queue interface {
+	Add(v interface{}) interface{}
+	AddPriority(v interface{}, priority int) interface{}
+	Remove(v interface{}) bool
+	FindPriority(v interface{}) (int, bool)
+	Pop() (interface{}, bool)
+	Shift() (interface{}, bool)
+	First() (interface{}, bool)
+	Last() (interface{}, bool)
+}
+
+var _ Queue = (*ShuffledPriorityQueue)(nil)
@@ -0,0 +1,234 @@
+// Package queuetest checks that implementations of the Queue interface behave like ShuffledPriorityQueue.
+// Every backend runs the same checks so that they can be swapped with each other.
+// The checks only use string values so that remote and persistent backends can store them.
+package queuetest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	spq "github.com/theodesp/go-shuffled-queue"
+	"github.com/theodesp/go-shuffled-queue/fairness"
+)
+
+// How many times the fairness check empties a bucket of three items.
+const fairnessTrials = 1200
+
+// A check of the behaviour shared by every queue. It is given an empty queue.
+type check struct {
+	name string
+	run  func(q spq.Queue) error
+}
+
+var checks = []check{
+	{"empty", checkEmpty},
+	{"pop order", checkPopOrder},
+	{"shift order", checkShiftOrder},
+	{"default priority", checkDefaultPriority},
+	{"duplicates", checkDuplicates},
+	{"priorities of a value", checkPriorities},
+	{"peek", checkPeek},
+	{"remove", checkRemove},
+	{"fairness", checkFairness},
+}
+
+// Runs every check against a new empty queue made by newQueue.
+// Returns an error describing the first check that failed or nil if the queue conforms.
+// Queues picking at random fail the fairness check with probability fairness.DefaultAlpha,
+// seeding their tie breaker makes the check deterministic.
+func Check(newQueue func() spq.Queue) error {
+	for _, c := range checks {
+		if err := c.run(newQueue()); err != nil {
+			return fmt.Errorf("queuetest: %s: %v", c.name, err)
+		}
+	}
+
+	return nil
+}
+
+func checkEmpty(q spq.Queue) error {
+	if v, ok := q.Pop(); ok {
+		return fmt.Errorf("Pop returned %v", v)
+	}
+
+	if v, ok := q.Shift(); ok {
+		return fmt.Errorf("Shift returned %v", v)
+	}
+
+	if v, ok := q.First(); ok {
+		return fmt.Errorf("First returned %v", v)
+	}
+
+	if v, ok := q.Last(); ok {
+		return fmt.Errorf("Last returned %v", v)
+	}
+
+	if p, ok := q.FindPriority("hello"); ok || p != -1 {
+		return fmt.Errorf("FindPriority returned %d, %v", p, ok)
+	}
+
+	if q.Remove("hello") {
+		return fmt.Errorf("Remove returned true")
+	}
+
+	return nil
+}
+
+func checkPopOrder(q spq.Queue) error {
+	addAll(q, map[string]int{"a": 3, "b": -5, "c": 10, "d": 0})
+
+	return expectOrder(q.Pop, "c", "a", "d", "b")
+}
+
+func checkShiftOrder(q spq.Queue) error {
+	addAll(q, map[string]int{"a": 3, "b": -5, "c": 10, "d": 0})
+
+	return expectOrder(q.Shift, "b", "d", "a", "c")
+}
+
+func checkDefaultPriority(q spq.Queue) error {
+	if v := q.Add("hello"); v != "hello" {
+		return fmt.Errorf("Add returned %v", v)
+	}
+
+	if v := q.AddPriority("world", 1); v != "world" {
+		return fmt.Errorf("AddPriority returned %v", v)
+	}
+
+	if p, ok := q.FindPriority("hello"); !ok || p != spq.DefaultPriority {
+		return fmt.Errorf("FindPriority returned %d, %v", p, ok)
+	}
+
+	return expectOrder(q.Shift, "hello", "world")
+}
+
+func checkDuplicates(q spq.Queue) error {
+	q.AddPriority("hello", 1)
+	q.AddPriority("hello", 1)
+
+	return expectOrder(q.Pop, "hello")
+}
+
+func checkPriorities(q spq.Queue) error {
+	q.AddPriority("hello", 7)
+	q.AddPriority("hello", 2)
+
+	if p, ok := q.FindPriority("hello"); !ok || p != 2 {
+		return fmt.Errorf("FindPriority returned %d, %v instead of the lowest priority", p, ok)
+	}
+
+	if !q.Remove("hello") {
+		return fmt.Errorf("Remove returned false")
+	}
+
+	if p, ok := q.FindPriority("hello"); !ok || p != 7 {
+		return fmt.Errorf("FindPriority returned %d, %v after removing the lowest priority", p, ok)
+	}
+
+	return expectOrder(q.Pop, "hello")
+}
+
+func checkPeek(q spq.Queue) error {
+	addAll(q, map[string]int{"a": 1, "b": 2, "c": 3})
+
+	for i := 0; i < 2; i += 1 {
+		if v, ok := q.First(); !ok || v != "a" {
+			return fmt.Errorf("First returned %v, %v", v, ok)
+		}
+
+		if v, ok := q.Last(); !ok || v != "c" {
+			return fmt.Errorf("Last returned %v, %v", v, ok)
+		}
+	}
+
+	return expectOrder(q.Pop, "c", "b", "a")
+}
+
+func checkRemove(q spq.Queue) error {
+	addAll(q, map[string]int{"a": 1, "b": 1, "c": 2})
+
+	if !q.Remove("b") || q.Remove("b") {
+		return fmt.Errorf("Remove did not remove the value exactly once")
+	}
+
+	if p, ok := q.FindPriority("b"); ok {
+		return fmt.Errorf("FindPriority returned %d after Remove", p)
+	}
+
+	return expectOrder(q.Pop, "c", "a")
+}
+
+// Empties a bucket of three items many times and checks that every pop order occurs equally often.
+func checkFairness(q spq.Queue) error {
+	items := []string{"a", "b", "c"}
+	orders := map[string]int{}
+	firsts := make([]int, len(items))
+
+	for trial := 0; trial < fairnessTrials; trial += 1 {
+		for _, item := range items {
+			q.AddPriority(item, 1)
+		}
+
+		order := ""
+		for range items {
+			v, ok := q.Pop()
+			if !ok {
+				return fmt.Errorf("Pop returned no value before the bucket was empty")
+			}
+			order += v.(string)
+		}
+
+		orders[order] += 1
+		firsts[strings.Index("abc", order[:1])] += 1
+	}
+
+	if _, pValue := fairness.ChiSquare(firsts); pValue < fairness.DefaultAlpha {
+		return fmt.Errorf("first pops %v are not uniform (chi-square p-value %.3g)", firsts, pValue)
+	}
+
+	counts := []int{}
+	for _, order := range []string{"abc", "acb", "bac", "bca", "cab", "cba"} {
+		counts = append(counts, orders[order])
+	}
+
+	if _, pValue := fairness.ChiSquare(counts); pValue < fairness.DefaultAlpha {
+		return fmt.Errorf("pop orders %v are not uniform (chi-square p-value %.3g)", orders, pValue)
+	}
+
+	return nil
+}
+
+// Adds the values in sorted order so that queues breaking ties in insertion order fail the same way every run.
+func addAll(q spq.Queue, priorities map[string]int) {
+	values := make([]string, 0, len(priorities))
+	for v := range priorities {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+
+	for _, v := range values {
+		q.AddPriority(v, priorities[v])
+	}
+}
+
+// Takes every value out of the queue and compares them with the expected ones.
+func expectOrder(take func() (interface{}, bool), expected ...string) error {
+	for i, e := range expected {
+		v, ok := take()
+
+		if !ok {
+			return fmt.Errorf("got %d values instead of %d", i, len(expected))
+		}
+
+		if v != e {
+			return fmt.Errorf("got %v instead of %v at position %d", v, e, i)
+		}
+	}
+
+	if v, ok := take(); ok {
+		return fmt.Errorf("got the extra value %v", v)
+	}
+
+	return nil
+}
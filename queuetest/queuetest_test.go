@@ -0,0 +1,59 @@
+package queuetest
+
+import (
+	"math/rand"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	spq "github.com/theodesp/go-shuffled-queue"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type QueueTestSuite struct{}
+
+var _ = Suite(&QueueTestSuite{})
+
+// A queue forgetting the priority of its items.
+type flatQueue struct {
+	*spq.ShuffledPriorityQueue
+}
+
+func (q flatQueue) AddPriority(v interface{}, priority int) interface{} {
+	return q.ShuffledPriorityQueue.AddPriority(v, 0)
+}
+
+// Test the shuffled priority queue conforms.
+func (s *QueueTestSuite) TestCheck(c *C) {
+	c.Assert(Check(func() spq.Queue {
+		q := spq.NewSPQ()
+		q.SetTieBreaker(spq.NewRandomTieBreaker(rand.NewSource(1)))
+		return q
+	}), IsNil)
+}
+
+// Test a queue ignoring priorities fails.
+func (s *QueueTestSuite) TestCheckOrder(c *C) {
+	err := Check(func() spq.Queue {
+		q := spq.NewSPQ()
+		q.SetTieBreaker(spq.NewFIFOTieBreaker())
+		return flatQueue{q}
+	})
+
+	c.Assert(err, ErrorMatches, "queuetest: pop order: got a instead of c at position 0")
+}
+
+// Test a queue popping items with the same priority in insertion order fails.
+func (s *QueueTestSuite) TestCheckFairness(c *C) {
+	err := Check(func() spq.Queue {
+		q := spq.NewSPQ()
+		q.SetTieBreaker(spq.NewFIFOTieBreaker())
+		return q
+	})
+
+	c.Assert(err, ErrorMatches, "queuetest: fairness: first pops \\[1200 0 0\\] are not uniform .*")
+}
@@ -0,0 +1,54 @@
+package go_shuffled_queue
+
+import (
+	"math/rand"
+	"time"
+)
+
+// A pseudo random generator whose state can be copied, so that copies of a queue make their own random choices
+// without drawing from the generator of the queue.
+type random struct {
+	*rand.Rand
+	src *splitMix
+}
+
+// A splitmix64 source, small enough to be copied by value.
+type splitMix struct {
+	state uint64
+}
+
+// Creates a generator seeded from src, drawing a single value from it.
+// If src is nil the generator is seeded with the current time.
+func newRand(src rand.Source) *random {
+	seed := time.Now().UTC().UnixNano()
+	if src != nil {
+		seed = src.Int63()
+	}
+
+	s := &splitMix{state: uint64(seed)}
+	return &random{Rand: rand.New(s), src: s}
+}
+
+// Returns a generator in the same state which makes the same choices from now on, independently of r.
+func (r *random) clone() *random {
+	s := *r.src
+	return &random{Rand: rand.New(&s), src: &s}
+}
+
+func (s *splitMix) Seed(seed int64) {
+	s.state = uint64(seed)
+}
+
+func (s *splitMix) Uint64() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+
+	z := s.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+
+	return z ^ (z >> 31)
+}
+
+func (s *splitMix) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
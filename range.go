@@ -0,0 +1,97 @@
+package go_shuffled_queue
+
+import (
+	"sort"
+)
+
+// Removes all the items with the specified priority.
+// Returns the number of items removed.
+func (spq *ShuffledPriorityQueue) RemovePriority(priority int) int {
+	return spq.RemoveRange(priority, priority)
+}
+
+// Removes all the items with a priority between min and max inclusive.
+// Returns the number of items removed.
+func (spq *ShuffledPriorityQueue) RemoveRange(min, max int) int {
+	defer spq.checkInvariants("RemoveRange")
+
+	lo, hi := spq.keyRange(min, max)
+	removed := 0
+
+	for _, priority := range spq.keys[lo:hi] {
+		b := spq.priorities[priority]
+		removed += b.size
+
+		if b.handles > 0 {
+			spq.invalidateHandles(b)
+		}
+
+		b.release()
+		delete(spq.priorities, priority)
+		spq.dropped(priority)
+	}
+
+	spq.keys = append(spq.keys[:lo], spq.keys[hi:]...)
+	spq.length -= uint(removed)
+
+	return removed
+}
+
+// Returns the number of items with a priority between min and max inclusive.
+func (spq *ShuffledPriorityQueue) CountRange(min, max int) int {
+	lo, hi := spq.keyRange(min, max)
+	count := 0
+
+	for _, priority := range spq.keys[lo:hi] {
+		count += spq.priorities[priority].size
+	}
+
+	return count
+}
+
+// Removes and returns the highest priority item with a priority between min and max inclusive.
+// If multiple items have the same priority one is picked by the tie breaker.
+// Returns true if found otherwise false.
+func (spq *ShuffledPriorityQueue) PopRange(min, max int) (interface{}, bool) {
+	defer spq.checkInvariants("PopRange")
+
+	lo, hi := spq.keyRange(min, max)
+
+	priority, ok := spq.allowedKey(lo, hi, true)
+	if !ok {
+		return nil, false
+	}
+
+	_, payload := spq.take(priority)
+	return payload, true
+}
+
+// Returns the priorities holding at least one item in ascending order.
+func (spq *ShuffledPriorityQueue) Priorities() []int {
+	return append([]int{}, spq.keys...)
+}
+
+// Returns the items with the specified priority in insertion order. Does not mutate the queue.
+func (spq *ShuffledPriorityQueue) PeekBucket(priority int) []interface{} {
+	b, ok := spq.priorities[priority]
+
+	if !ok {
+		return []interface{}{}
+	}
+
+	return b.values()
+}
+
+// Returns the bounds of the keys between min and max inclusive.
+func (spq *ShuffledPriorityQueue) keyRange(min, max int) (int, int) {
+	if min > max {
+		return 0, 0
+	}
+
+	lo := sort.SearchInts(spq.keys, min)
+	hi := lo + sort.Search(len(spq.keys)-lo, func(i int) bool {
+		return spq.keys[lo+i] > max
+	})
+
+	return lo, hi
+}
@@ -0,0 +1,108 @@
+package go_shuffled_queue
+
+import (
+	"math"
+
+	. "gopkg.in/check.v1"
+)
+
+func newRangeSPQ() *ShuffledPriorityQueue {
+	spq := NewSPQ()
+
+	spq.AddPriority("Atme", -3)
+	spq.AddPriority("welt", 1)
+	spq.AddPriority("world", 3)
+	spq.AddPriority("mold", 3)
+	spq.AddPriority("hello", 5)
+	spq.AddPriority("verden", 10)
+
+	return spq
+}
+
+// Test RemovePriority removes the whole bucket.
+func (s *MySuite) TestRemovePriority(c *C) {
+	spq := newRangeSPQ()
+
+	c.Assert(spq.RemovePriority(3), Equals, 2)
+	c.Assert(spq.RemovePriority(3), Equals, 0)
+	c.Assert(spq.length, Equals, uint(4))
+	c.Assert(spq.keys, DeepEquals, []int{-3, 1, 5, 10})
+
+	_, found := spq.FindPriority("world")
+	c.Assert(found, Equals, false)
+}
+
+// Test RemoveRange removes every bucket within the bounds inclusive.
+func (s *MySuite) TestRemoveRange(c *C) {
+	spq := newRangeSPQ()
+
+	c.Assert(spq.RemoveRange(math.MinInt32, 2), Equals, 2)
+	c.Assert(spq.keys, DeepEquals, []int{3, 5, 10})
+	c.Assert(spq.RemoveRange(5, math.MaxInt64), Equals, 2)
+	c.Assert(spq.keys, DeepEquals, []int{3})
+	c.Assert(spq.length, Equals, uint(2))
+}
+
+// Test RemoveRange with empty or inverted bounds.
+func (s *MySuite) TestRemoveRangeNoMatch(c *C) {
+	spq := newRangeSPQ()
+
+	c.Assert(spq.RemoveRange(6, 9), Equals, 0)
+	c.Assert(spq.RemoveRange(10, 5), Equals, 0)
+	c.Assert(spq.length, Equals, uint(6))
+}
+
+// Test CountRange counts the items within the bounds inclusive.
+func (s *MySuite) TestCountRange(c *C) {
+	spq := newRangeSPQ()
+
+	c.Assert(spq.CountRange(1, 5), Equals, 4)
+	c.Assert(spq.CountRange(3, 3), Equals, 2)
+	c.Assert(spq.CountRange(-2, 0), Equals, 0)
+	c.Assert(spq.CountRange(math.MinInt64, math.MaxInt64), Equals, 6)
+	c.Assert(NewSPQ().CountRange(0, 10), Equals, 0)
+}
+
+// Test PopRange pops the highest priority item within the bounds.
+func (s *MySuite) TestPopRange(c *C) {
+	spq := newRangeSPQ()
+
+	item, ok := spq.PopRange(0, 4)
+
+	c.Assert(ok, Equals, true)
+	c.Assert(contains([]string{"world", "mold"}, item.(string)), Equals, true)
+	c.Assert(spq.length, Equals, uint(5))
+
+	spq.PopRange(0, 4)
+	item, ok = spq.PopRange(0, 4)
+
+	c.Assert(ok, Equals, true)
+	c.Assert(item, Equals, "welt")
+
+	item, ok = spq.PopRange(0, 4)
+
+	c.Assert(item, IsNil)
+	c.Assert(ok, Equals, false)
+}
+
+// Test PeekBucket returns the items of a priority without mutating the queue.
+func (s *MySuite) TestPeekBucket(c *C) {
+	spq := newRangeSPQ()
+
+	c.Assert(spq.PeekBucket(3), DeepEquals, []interface{}{"world", "mold"})
+	c.Assert(spq.PeekBucket(4), DeepEquals, []interface{}{})
+	c.Assert(spq.length, Equals, uint(6))
+}
+
+// Test Priorities returns a copy of the priorities holding items.
+func (s *MySuite) TestPriorities(c *C) {
+	spq := newRangeSPQ()
+
+	priorities := spq.Priorities()
+	c.Assert(priorities, DeepEquals, []int{-3, 1, 3, 5, 10})
+
+	priorities[0] = 0
+	c.Assert(spq.Priorities()[0], Equals, -3)
+	c.Assert(spq.Len(), Equals, 6)
+	c.Assert(NewSPQ().Priorities(), DeepEquals, []int{})
+}
@@ -0,0 +1,204 @@
+package go_shuffled_queue
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// A token bucket limiting how many items are taken out of a range of priorities per second.
+type tokenBucket struct {
+	min, max int
+	rate     float64
+	burst    float64
+	tokens   float64
+	last     time.Time
+}
+
+// Clocks may also implement After to wake up the blocking pops waiting for a rate limit,
+// otherwise they wait on a timer of the operating system.
+type afterClock interface {
+	After(d time.Duration) <-chan time.Time
+}
+
+// Limits how many items of the specified priority are taken out per second, see SetRateLimitRange.
+func (spq *ShuffledPriorityQueue) SetRateLimit(priority int, rate float64, burst int) {
+	spq.SetRateLimitRange(priority, priority, rate, burst)
+}
+
+// Limits how many items with a priority between min and max inclusive are taken out per second.
+// The priorities of the range share a bucket of burst tokens, starting full and refilled at rate tokens per second
+// according to the queue clock. Taking an item out spends a token, pops skip the priorities without one and take
+// from the next priority in order instead. Limits set later take precedence over earlier ones for the priorities
+// they cover, and replace the limit of the same range if there is one. A rate of 0 or less lifts the limit.
+// Peeking is never limited.
+func (spq *ShuffledPriorityQueue) SetRateLimitRange(min, max int, rate float64, burst int) {
+	if burst < 1 {
+		burst = 1
+	}
+
+	for i, tb := range spq.limits {
+		if tb.min == min && tb.max == max {
+			spq.limits = append(spq.limits[:i], spq.limits[i+1:]...)
+			break
+		}
+	}
+
+	spq.limits = append(spq.limits, &tokenBucket{
+		min:    min,
+		max:    max,
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   spq.clock.Now()})
+}
+
+// Returns copies of the token buckets of the queue holding the tokens it has left.
+func (spq *ShuffledPriorityQueue) copyLimits() []*tokenBucket {
+	limits := make([]*tokenBucket, len(spq.limits))
+
+	for i, tb := range spq.limits {
+		limit := *tb
+		limits[i] = &limit
+	}
+
+	return limits
+}
+
+// Removes and returns the highest priority item, waiting until one is added or a rate limit lets one out.
+// Returns ErrClosed once the queue is closed and empty, or the context error once it is done.
+// The queue is not thread safe: while it waits other goroutines may only call Feed, Stream and Close.
+func (spq *ShuffledPriorityQueue) BlockingPop(ctx context.Context) (interface{}, error) {
+	return spq.blockingTake(ctx, spq.TryPop)
+}
+
+// Removes and returns the lowest priority item, waiting until one is added or a rate limit lets one out.
+// Returns ErrClosed once the queue is closed and empty, or the context error once it is done.
+// The queue is not thread safe: while it waits other goroutines may only call Feed, Stream and Close.
+func (spq *ShuffledPriorityQueue) BlockingShift(ctx context.Context) (interface{}, error) {
+	return spq.blockingTake(ctx, spq.TryShift)
+}
+
+func (spq *ShuffledPriorityQueue) blockingTake(ctx context.Context, take func() (interface{}, error)) (interface{}, error) {
+	for {
+		spq.pipe.mu.Lock()
+		item, err := take()
+		if err == nil {
+			spq.pipe.broadcast(&spq.pipe.taken)
+		}
+		added := spq.pipe.added
+		var token <-chan time.Time
+		if err == ErrRateLimited {
+			token = spq.nextToken()
+		}
+		spq.pipe.mu.Unlock()
+
+		if err != ErrEmpty && err != ErrRateLimited {
+			return item, err
+		}
+
+		select {
+		case <-added:
+		case <-token:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Returns the highest or the lowest of the keys between the indexes lo and hi whose priority has a token to spend,
+// spending it. Returns false if every one of them is rate limited.
+func (spq *ShuffledPriorityQueue) allowedKey(lo, hi int, highest bool) (int, bool) {
+	for i := lo; i < hi; i += 1 {
+		priority := spq.keys[i]
+		if highest {
+			priority = spq.keys[lo+hi-1-i]
+		}
+
+		if spq.allow(priority) {
+			return priority, true
+		}
+	}
+
+	return 0, false
+}
+
+// Spends a token of the specified priority. Returns false if it has none left.
+// The clock is only read for limited priorities.
+func (spq *ShuffledPriorityQueue) allow(priority int) bool {
+	tb := spq.limiter(priority)
+	if tb == nil {
+		return true
+	}
+
+	tb.refill(spq.clock.Now())
+	if tb.tokens < 1 {
+		return false
+	}
+
+	tb.tokens -= 1
+	return true
+}
+
+// Returns the bucket limiting the specified priority or nil if it is not limited.
+func (spq *ShuffledPriorityQueue) limiter(priority int) *tokenBucket {
+	for i := len(spq.limits) - 1; i >= 0; i -= 1 {
+		tb := spq.limits[i]
+		if priority < tb.min || priority > tb.max {
+			continue
+		}
+
+		if tb.rate <= 0 {
+			return nil
+		}
+		return tb
+	}
+
+	return nil
+}
+
+// Returns a channel receiving once the first rate limited priority holding items gets a token,
+// or nil if no priority holding items is waiting for one. Must be called with the pipe lock held.
+func (spq *ShuffledPriorityQueue) nextToken() <-chan time.Time {
+	if len(spq.limits) == 0 {
+		return nil
+	}
+
+	now := spq.clock.Now()
+	wait := time.Duration(math.MaxInt64)
+
+	for _, priority := range spq.keys {
+		if tb := spq.limiter(priority); tb != nil {
+			if d := tb.wait(now); d > 0 && d < wait {
+				wait = d
+			}
+		}
+	}
+
+	if wait == time.Duration(math.MaxInt64) {
+		return nil
+	}
+
+	if c, ok := spq.clock.(afterClock); ok {
+		return c.After(wait)
+	}
+	return time.After(wait)
+}
+
+// Adds the tokens earned since the last refill.
+func (tb *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(tb.last); elapsed > 0 {
+		tb.tokens = math.Min(tb.burst, tb.tokens+elapsed.Seconds()*tb.rate)
+		tb.last = now
+	}
+}
+
+// Returns how long until the bucket holds a token.
+func (tb *tokenBucket) wait(now time.Time) time.Duration {
+	tb.refill(now)
+	if tb.tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration(math.Ceil((1 - tb.tokens) / tb.rate * float64(time.Second)))
+}
@@ -0,0 +1,328 @@
+package go_shuffled_queue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+// A clock only moving when advanced, waking up the goroutines waiting on it.
+type manualClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []manualTimer
+	waiting chan struct{}
+}
+
+type manualTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newManualClock() *manualClock {
+	return &manualClock{now: time.Unix(0, 0), waiting: make(chan struct{}, 16)}
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *manualClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := manualTimer{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.timers = append(c.timers, t)
+	c.waiting <- struct{}{}
+
+	return t.c
+}
+
+func (c *manualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	timers := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			timers = append(timers, t)
+			continue
+		}
+		t.c <- c.now
+	}
+	c.timers = timers
+}
+
+// Test Pop skips a rate limited priority and takes from the next one until a token is earned.
+func (s *MySuite) TestRateLimitSkipsPriority(c *C) {
+	clock := newManualClock()
+	spq := NewSPQ()
+	spq.SetClock(clock)
+	spq.SetRateLimit(10, 1, 2)
+
+	for i := 0; i < 4; i += 1 {
+		spq.AddPriority(i, 10)
+		spq.AddPriority(-i-1, 0)
+	}
+
+	for i := 0; i < 2; i += 1 {
+		_, ok := spq.Pop()
+		c.Assert(ok, Equals, true)
+	}
+	c.Assert(spq.CountRange(10, 10), Equals, 2)
+
+	item, ok := spq.Pop()
+	c.Assert(ok, Equals, true)
+	c.Assert(item.(int) < 0, Equals, true)
+
+	// Half a token is not enough
+	clock.Advance(500 * time.Millisecond)
+	item, _ = spq.Pop()
+	c.Assert(item.(int) < 0, Equals, true)
+
+	clock.Advance(500 * time.Millisecond)
+	item, _ = spq.Pop()
+	c.Assert(item.(int) >= 0, Equals, true)
+	c.Assert(spq.Validate(), IsNil)
+}
+
+// Test the priorities of a range share their tokens and Shift is limited too.
+func (s *MySuite) TestRateLimitRange(c *C) {
+	clock := newManualClock()
+	spq := NewSPQ()
+	spq.SetClock(clock)
+	spq.SetRateLimitRange(0, 5, 20, 1)
+
+	spq.AddPriority("hello", 3)
+	spq.AddPriority("world", 4)
+
+	item, err := spq.TryShift()
+	c.Assert(err, IsNil)
+	c.Assert(item, Equals, "hello")
+
+	_, err = spq.TryPop()
+	c.Assert(err, Equals, ErrRateLimited)
+	_, ok := spq.PopEnvelope()
+	c.Assert(ok, Equals, false)
+	_, ok = spq.PopRange(0, 10)
+	c.Assert(ok, Equals, false)
+
+	// Peeking is not limited
+	item, ok = spq.Last()
+	c.Assert(ok, Equals, true)
+	c.Assert(item, Equals, "world")
+
+	clock.Advance(50 * time.Millisecond)
+	item, ok = spq.Pop()
+	c.Assert(ok, Equals, true)
+	c.Assert(item, Equals, "world")
+}
+
+// Test later limits take precedence and a rate of 0 lifts the limit.
+func (s *MySuite) TestRateLimitPrecedence(c *C) {
+	spq := NewSPQ()
+	spq.SetClock(newManualClock())
+	spq.SetRateLimitRange(0, 10, 1, 1)
+	spq.SetRateLimit(5, 0, 0)
+
+	for i := 0; i < 3; i += 1 {
+		spq.AddPriority(i, 5)
+	}
+
+	for i := 0; i < 3; i += 1 {
+		_, ok := spq.Pop()
+		c.Assert(ok, Equals, true)
+	}
+
+	spq.AddPriority("hello", 1)
+	spq.AddPriority("world", 2)
+	_, ok := spq.Pop()
+	c.Assert(ok, Equals, true)
+	_, err := spq.TryPop()
+	c.Assert(err, Equals, ErrRateLimited)
+}
+
+// Test setting the limit of a range again replaces it and takes precedence over the limits set in between.
+func (s *MySuite) TestRateLimitReplace(c *C) {
+	spq := NewSPQ()
+	spq.SetClock(newManualClock())
+	spq.SetRateLimit(5, 1, 1)
+	spq.SetRateLimitRange(0, 10, 1, 1)
+	spq.SetRateLimit(5, 0, 0)
+	c.Assert(spq.limits, HasLen, 2)
+
+	for i := 0; i < 3; i += 1 {
+		spq.AddPriority(i, 5)
+	}
+
+	for i := 0; i < 3; i += 1 {
+		_, ok := spq.Pop()
+		c.Assert(ok, Equals, true)
+	}
+}
+
+// Test rate limits set before the clock refill from the time of the new clock.
+func (s *MySuite) TestRateLimitSetClock(c *C) {
+	spq := NewSPQ()
+	spq.SetRateLimit(1, 1, 1)
+
+	clock := newManualClock()
+	spq.SetClock(clock)
+
+	spq.AddPriority("hello", 1)
+	spq.AddPriority("world", 1)
+
+	_, err := spq.TryPop()
+	c.Assert(err, IsNil)
+	_, err = spq.TryPop()
+	c.Assert(err, Equals, ErrRateLimited)
+
+	clock.Advance(time.Second)
+	_, err = spq.TryPop()
+	c.Assert(err, IsNil)
+}
+
+// Test clones and snapshots keep the rate limits with their own tokens.
+func (s *MySuite) TestRateLimitCopies(c *C) {
+	spq := NewSPQ()
+	spq.SetClock(newManualClock())
+	spq.SetRateLimit(1, 1, 2)
+
+	for i := 0; i < 4; i += 1 {
+		spq.AddPriority(i, 1)
+	}
+
+	_, err := spq.TryPop()
+	c.Assert(err, IsNil)
+
+	for _, q := range []*ShuffledPriorityQueue{spq.Clone(), spq.Snapshot()} {
+		_, err = q.TryPop()
+		c.Assert(err, IsNil)
+		_, err = q.TryPop()
+		c.Assert(err, Equals, ErrRateLimited)
+	}
+
+	_, err = spq.TryPop()
+	c.Assert(err, IsNil)
+	_, err = spq.TryPop()
+	c.Assert(err, Equals, ErrRateLimited)
+}
+
+// Test a blocking pop waits for a token when every priority holding items is rate limited.
+func (s *MySuite) TestBlockingPopWaitsForToken(c *C) {
+	clock := newManualClock()
+	spq := NewSPQ()
+	spq.SetClock(clock)
+	spq.SetRateLimit(1, 100, 1)
+
+	spq.AddPriority("hello", 1)
+	spq.AddPriority("world", 1)
+	_, ok := spq.Pop()
+	c.Assert(ok, Equals, true)
+
+	done := make(chan interface{})
+	go func() {
+		item, err := spq.BlockingPop(context.Background())
+		c.Check(err, IsNil)
+		done <- item
+	}()
+
+	<-clock.waiting
+	select {
+	case <-done:
+		c.Fatal("popped without a token")
+	default:
+	}
+
+	clock.Advance(10 * time.Millisecond)
+	c.Assert(<-done, NotNil)
+	c.Assert(spq.Len(), Equals, 0)
+}
+
+// Test a blocking shift waits for an item and returns ErrClosed once the queue is closed and empty.
+func (s *MySuite) TestBlockingShiftWaitsForItem(c *C) {
+	spq := NewSPQ()
+
+	in := make(chan Item)
+	go spq.Feed(context.Background(), in)
+
+	done := make(chan interface{})
+	go func() {
+		item, err := spq.BlockingShift(context.Background())
+		c.Check(err, IsNil)
+		done <- item
+	}()
+
+	in <- Item{Value: "hello", Priority: 1}
+	c.Assert(<-done, Equals, "hello")
+
+	spq.Close()
+	_, err := spq.BlockingShift(context.Background())
+	c.Assert(err, Equals, ErrClosed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = NewSPQ().BlockingPop(ctx)
+	c.Assert(err, Equals, context.Canceled)
+}
+
+// Test a stream waits for tokens instead of ending while items are rate limited.
+func (s *MySuite) TestStreamRateLimited(c *C) {
+	clock := newManualClock()
+	spq := NewSPQ()
+	spq.SetClock(clock)
+	spq.SetRateLimit(1, 1, 1)
+
+	spq.AddPriority("hello", 1)
+	spq.AddPriority("world", 1)
+	spq.Close()
+
+	out := spq.Stream(context.Background())
+	c.Assert((<-out).Value, NotNil)
+
+	<-clock.waiting
+	clock.Advance(time.Second)
+
+	_, ok := <-out
+	c.Assert(ok, Equals, true)
+	_, ok = <-out
+	c.Assert(ok, Equals, false)
+}
+
+// Test the dispatcher waits for tokens before taking rate limited items.
+func (s *MySuite) TestDispatcherRateLimited(c *C) {
+	clock := newManualClock()
+	spq := NewSPQ()
+	spq.SetClock(clock)
+	spq.SetRateLimit(1, 1, 1)
+
+	spq.AddPriority("hello", 1)
+	spq.AddPriority("world", 1)
+	spq.Close()
+
+	handled := make(chan interface{}, 2)
+	d := NewDispatcher(spq, 2, func(ctx context.Context, env *Envelope) error {
+		handled <- env.Value
+		return nil
+	})
+
+	done := make(chan error)
+	go func() {
+		done <- d.Run(context.Background())
+	}()
+
+	<-handled
+	<-clock.waiting
+	c.Assert(len(handled), Equals, 0)
+
+	clock.Advance(time.Second)
+	<-handled
+	c.Assert(<-done, IsNil)
+}
@@ -0,0 +1,102 @@
+package go_shuffled_queue
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// Sets the source of the random choices of SampleN.
+// If src is nil a source seeded with the current time is used.
+func (spq *ShuffledPriorityQueue) SetSampleSource(src rand.Source) {
+	spq.sampler = newRand(src)
+}
+
+// Returns up to k distinct items picked at random from the highest priority bucket,
+// spilling into lower priority buckets in order when a bucket holds fewer items than needed.
+// Returns the payload of keyed items. Does not mutate the queue. Takes time in O(k) unless
+// the buckets reached hold fewer items than needed.
+func (spq *ShuffledPriorityQueue) SampleN(k int) []interface{} {
+	sample := []interface{}{}
+
+	for i := len(spq.keys) - 1; i >= 0 && len(sample) < k; i -= 1 {
+		b := spq.priorities[spq.keys[i]]
+
+		// Walk a lazily shuffled permutation of the slots, skipping the holes left by removed items.
+		// Compaction keeps at least half of the slots of large buckets filled.
+		perm := &epoch{size: len(b.slots), swapped: make(map[int]int)}
+
+		for perm.next < perm.size && len(sample) < k {
+			if slot := perm.draw(spq.sampler); b.weights[slot] > 0 {
+				sample = append(sample, b.value(b.slots[slot]))
+			}
+		}
+	}
+
+	return sample
+}
+
+// Returns up to k items in the order k consecutive Pops would return them. Does not mutate the queue:
+// the picks are made by copies of the tie breakers, so the following Pops return exactly these items with
+// the built in tie breakers. Rate limits are ignored, the items are listed as if every priority had tokens left.
+func (spq *ShuffledPriorityQueue) PeekN(k int) []interface{} {
+	return spq.peekN(k, true)
+}
+
+// Returns up to k items in the order k consecutive Shifts would return them. Does not mutate the queue:
+// the picks are made by copies of the tie breakers, so the following Shifts return exactly these items with
+// the built in tie breakers. Rate limits are ignored, the items are listed as if every priority had tokens left.
+func (spq *ShuffledPriorityQueue) PeekLowestN(k int) []interface{} {
+	return spq.peekN(k, false)
+}
+
+// Picks items out of the buckets with copies of the tie breakers, starting from the highest or the lowest priority,
+// as if the picked occurrences were taken out: the tie breakers are shown the buckets without them.
+func (spq *ShuffledPriorityQueue) peekN(k int, highest bool) []interface{} {
+	peeked := []interface{}{}
+	scratch := spq.emptyCopy()
+
+	for i := 0; i < len(spq.keys) && len(peeked) < k; i += 1 {
+		priority := spq.keys[i]
+		if highest {
+			priority = spq.keys[len(spq.keys)-1-i]
+		}
+
+		b := spq.priorities[priority]
+		tb := scratch.tieBreakerOf(priority)
+		w, watching := tb.(bucketWatcher)
+
+		// The indexes of the bucket of the occurrences taken so far, sorted
+		var taken []int
+
+		// Returns the index in the bucket of an index in the bucket left: taken[j]-j grows with j and counts
+		// the occurrences left before taken[j], so the ones taken before the index are those with at most i left
+		original := func(i int) int {
+			return i + sort.Search(len(taken), func(j int) bool { return taken[j]-j > i })
+		}
+
+		value := func(i int) interface{} {
+			return b.valueAt(original(i))
+		}
+
+		for size := b.size; size > 0 && len(peeked) < k; size -= 1 {
+			v := b.at(original(tb.Pick(priority, size, value)))
+			peeked = append(peeked, b.value(v))
+
+			// Like remove, take the last occurrence of the item left. The ones taken before are the last of its run.
+			first := b.rank(v)
+			end := first + b.count(v)
+			last := end - 1 - (sort.SearchInts(taken, end) - sort.SearchInts(taken, first))
+			j := sort.SearchInts(taken, last)
+
+			taken = append(taken, 0)
+			copy(taken[j+1:], taken[j:])
+			taken[j] = last
+
+			if watching {
+				w.Removed(priority, last-j)
+			}
+		}
+	}
+
+	return peeked
+}
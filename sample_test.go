@@ -0,0 +1,205 @@
+package go_shuffled_queue
+
+import (
+	"math/rand"
+
+	. "gopkg.in/check.v1"
+)
+
+// Test SampleN picks distinct items from the top bucket first and spills into lower buckets.
+func (s *MySuite) TestSampleN(c *C) {
+	spq := newRangeSPQ()
+	spq.SetSampleSource(rand.NewSource(1))
+
+	c.Assert(spq.SampleN(1), DeepEquals, []interface{}{"verden"})
+
+	sample := spq.SampleN(3)
+	c.Assert(sample, HasLen, 3)
+	c.Assert(sample[:2], DeepEquals, []interface{}{"verden", "hello"})
+	c.Assert(contains([]string{"world", "mold"}, sample[2].(string)), Equals, true)
+
+	c.Assert(spq.SampleN(10), HasLen, 6)
+	c.Assert(spq.SampleN(0), DeepEquals, []interface{}{})
+	c.Assert(spq.length, Equals, uint(6))
+}
+
+// Test SampleN picks every item of a bucket with similar frequencies.
+func (s *MySuite) TestSampleNSpread(c *C) {
+	spq := NewSPQ()
+	spq.SetSampleSource(rand.NewSource(1))
+
+	for _, v := range []string{"a", "b", "c", "d"} {
+		spq.AddPriority(v, 1)
+	}
+
+	counts := map[interface{}]int{}
+	for i := 0; i < 4000; i += 1 {
+		sample := spq.SampleN(2)
+		c.Assert(sample[0] == sample[1], Equals, false)
+		counts[sample[0]] += 1
+	}
+
+	for _, count := range counts {
+		c.Assert(count > 800 && count < 1200, Equals, true)
+	}
+}
+
+// Test SampleN returns each item once in multiset mode and gives the payload of keyed items.
+func (s *MySuite) TestSampleNDistinct(c *C) {
+	spq := NewMultisetSPQ()
+	spq.AddPriority("hello", 1)
+	spq.AddPriority("hello", 1)
+	spq.AddKeyed("a", job{name: "build"}, 0)
+
+	c.Assert(spq.SampleN(3), DeepEquals, []interface{}{"hello", job{name: "build"}})
+}
+
+// Test PeekN and PeekLowestN return what Pops and Shifts would without mutating the queue.
+func (s *MySuite) TestPeekN(c *C) {
+	spq := newRangeSPQ()
+	spq.SetTieBreaker(NewFIFOTieBreaker())
+
+	c.Assert(spq.PeekN(4), DeepEquals, []interface{}{"verden", "hello", "world", "mold"})
+	c.Assert(spq.PeekLowestN(3), DeepEquals, []interface{}{"Atme", "welt", "world"})
+	c.Assert(spq.PeekN(10), HasLen, 6)
+	c.Assert(spq.PeekN(0), DeepEquals, []interface{}{})
+	c.Assert(spq.length, Equals, uint(6))
+	c.Assert(spq.Validate(), IsNil)
+
+	for _, v := range spq.PeekN(6) {
+		item, _ := spq.Pop()
+		c.Assert(item, Equals, v)
+	}
+}
+
+// Test PeekN leaves the state of the tie breakers alone so that the following Pops return the peeked items.
+func (s *MySuite) TestPeekNTieBreakerState(c *C) {
+	for _, tb := range []TieBreaker{
+		NewRandomTieBreaker(rand.NewSource(1)),
+		NewRoundRobinTieBreaker(),
+		NewShuffleTieBreaker(rand.NewSource(1))} {
+		spq := NewSPQ()
+		spq.SetTieBreaker(tb)
+		for i := 0; i < 20; i += 1 {
+			spq.AddPriority(i, i%2)
+		}
+
+		c.Assert(spq.PeekN(5), DeepEquals, spq.PeekN(5))
+
+		peeked := spq.PeekN(20)
+		for _, v := range peeked {
+			item, _ := spq.Pop()
+			c.Assert(item, Equals, v)
+		}
+	}
+}
+
+// Test PeekN ignores rate limits.
+func (s *MySuite) TestPeekNIgnoresRateLimits(c *C) {
+	spq := NewSPQ()
+	spq.SetClock(newManualClock())
+	spq.SetRateLimit(1, 1, 1)
+	spq.AddPriority("hello", 1)
+	spq.AddPriority("world", 1)
+	spq.AddPriority("welt", 0)
+
+	c.Assert(spq.PeekN(3), HasLen, 3)
+	spq.Pop()
+
+	// The next Pop skips the rate limited priority but PeekN does not
+	c.Assert(spq.PeekN(2), HasLen, 2)
+	item, _ := spq.Pop()
+	c.Assert(item, Equals, "welt")
+}
+
+// Test PeekN repeats items occurring more than once in multiset mode.
+func (s *MySuite) TestPeekNMultiset(c *C) {
+	spq := NewMultisetSPQ()
+	spq.AddPriority("hello", 1)
+	spq.AddPriority("hello", 1)
+	spq.AddPriority("world", 0)
+
+	c.Assert(spq.PeekN(3), DeepEquals, []interface{}{"hello", "hello", "world"})
+	c.Assert(spq.Count("hello"), Equals, 2)
+}
+
+// Test SampleN only picks the items left in a bucket after removals.
+func (s *MySuite) TestSampleNAfterRemovals(c *C) {
+	spq := NewSPQ()
+	spq.SetSampleSource(rand.NewSource(1))
+
+	for i := 0; i < 40; i += 1 {
+		spq.Add(i)
+	}
+	for i := 0; i < 40; i += 2 {
+		spq.Remove(i)
+	}
+
+	for k := 1; k <= 25; k += 6 {
+		expected := k
+		if expected > 20 {
+			expected = 20
+		}
+
+		sample := spq.SampleN(k)
+		c.Assert(sample, HasLen, expected)
+
+		seen := map[interface{}]bool{}
+		for _, v := range sample {
+			c.Assert(v.(int)%2, Equals, 1)
+			c.Assert(seen[v], Equals, false)
+			seen[v] = true
+		}
+	}
+}
+
+// Test PeekN returns what Pops would from buckets holding items more than once and holes left by removals.
+func (s *MySuite) TestPeekNMatchesPops(c *C) {
+	for _, tb := range []TieBreaker{
+		NewFIFOTieBreaker(),
+		NewLIFOTieBreaker(),
+		NewRandomTieBreaker(rand.NewSource(1)),
+		NewRoundRobinTieBreaker(),
+		NewShuffleTieBreaker(rand.NewSource(1)),
+		NewWeightedTieBreaker(func(v interface{}) float64 { return float64(v.(int) % 4) }, rand.NewSource(1))} {
+		spq := NewMultisetSPQ()
+		spq.SetTieBreaker(tb)
+
+		for i := 0; i < 30; i += 1 {
+			for j := 0; j <= i%3; j += 1 {
+				spq.AddPriority(i, i%2)
+			}
+		}
+		for i := 0; i < 30; i += 5 {
+			spq.Remove(i)
+		}
+		spq.Last()
+
+		peeked := spq.PeekN(spq.Len())
+		c.Assert(peeked, DeepEquals, popAll(spq))
+	}
+}
+
+func (s *MySuite) BenchmarkSampleNLargeBucket(c *C) {
+	spq := NewSPQ()
+	for i := 0; i < 100000; i += 1 {
+		spq.Add(i)
+	}
+
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		spq.SampleN(10)
+	}
+}
+
+func (s *MySuite) BenchmarkPeekNLargeBucket(c *C) {
+	spq := NewSPQ()
+	for i := 0; i < 100000; i += 1 {
+		spq.Add(i)
+	}
+
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		spq.PeekN(10)
+	}
+}
@@ -0,0 +1,299 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	spq "github.com/theodesp/go-shuffled-queue"
+)
+
+// The largest request body accepted when adding an item.
+const maxBodySize = 1 << 20
+
+// Returned for paths that are not one of the endpoints.
+var errNoEndpoint = errors.New("server: no such endpoint")
+
+// The methods allowed on every endpoint.
+var endpoints = map[string][]string{
+	"items":    {http.MethodPost, http.MethodDelete},
+	"priority": {http.MethodGet},
+	"pop":      {http.MethodPost},
+	"shift":    {http.MethodPost},
+	"first":    {http.MethodGet},
+	"last":     {http.MethodGet},
+	"stats":    {http.MethodGet}}
+
+// An item as sent and received over HTTP.
+type itemJSON struct {
+	Value    json.RawMessage `json:"value"`
+	Priority int             `json:"priority"`
+}
+
+// The statistics of a queue as received over HTTP.
+type statsJSON struct {
+	Length     int            `json:"length"`
+	Closed     bool           `json:"closed"`
+	Priorities []priorityJSON `json:"priorities"`
+}
+
+type priorityJSON struct {
+	Priority int `json:"priority"`
+	Count    int `json:"count"`
+}
+
+type errorJSON struct {
+	Error string `json:"error"`
+}
+
+// Serves the REST API of the hosted queues:
+//
+//	POST   /queues/{name}/items           adds the item {"value": ..., "priority": ...}
+//	DELETE /queues/{name}/items?value=    removes the value
+//	GET    /queues/{name}/priority?value= returns the lowest priority of the value
+//	POST   /queues/{name}/pop?wait=       removes the highest priority item, waiting up to wait for one
+//	POST   /queues/{name}/shift?wait=     removes the lowest priority item, waiting up to wait for one
+//	GET    /queues/{name}/first           returns the lowest priority value
+//	GET    /queues/{name}/last            returns the highest priority value
+//	GET    /queues/{name}/stats           returns the length and the number of items of every priority
+//
+// Values in query strings are JSON documents. Failures are answered with {"error": ...}.
+// Queues are created by their first add, the other endpoints answer for a missing queue as for an empty one.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, endpoint, ok := route(r.URL.EscapedPath())
+	methods, found := endpoints[endpoint]
+
+	if !ok || !found {
+		writeError(w, http.StatusNotFound, errNoEndpoint)
+		return
+	}
+
+	if !allowed(r.Method, methods) {
+		writeMethodNotAllowed(w, methods...)
+		return
+	}
+
+	// Only adding creates a queue, the other endpoints answer for a missing queue as for an empty one
+	switch endpoint {
+	case "items":
+		if r.Method == http.MethodPost {
+			s.serveAdd(w, r, s.queue(name))
+		} else {
+			s.serveRemove(w, r, s.existing(name))
+		}
+	case "priority":
+		s.serveFindPriority(w, r, s.existing(name))
+	case "pop", "shift":
+		s.serveTake(w, r, name, endpoint == "pop")
+	case "first", "last":
+		s.servePeek(w, s.existing(name), endpoint == "last")
+	case "stats":
+		s.serveStats(w, s.existing(name))
+	}
+}
+
+func (s *Server) serveAdd(w http.ResponseWriter, r *http.Request, h *hosted) {
+	var item itemJSON
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&item); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if item.Value == nil {
+		writeError(w, http.StatusBadRequest, errors.New("server: missing value"))
+		return
+	}
+
+	value, err := canonical(item.Value)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, err := h.add(value, item.Priority); err != nil {
+		writeError(w, status(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, itemJSON{Value: json.RawMessage(value), Priority: item.Priority})
+}
+
+func (s *Server) serveRemove(w http.ResponseWriter, r *http.Request, h *hosted) {
+	value, ok := queryValue(w, r)
+	if !ok {
+		return
+	}
+
+	var err error
+	h.do(func(q *spq.ShuffledPriorityQueue) {
+		err = q.TryRemove(value)
+	})
+
+	if err != nil {
+		writeError(w, status(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, itemJSON{Value: json.RawMessage(value)})
+}
+
+func (s *Server) serveFindPriority(w http.ResponseWriter, r *http.Request, h *hosted) {
+	value, ok := queryValue(w, r)
+	if !ok {
+		return
+	}
+
+	var priority int
+	var err error
+	h.do(func(q *spq.ShuffledPriorityQueue) {
+		priority, err = q.TryFindPriority(value)
+	})
+
+	if err != nil {
+		writeError(w, status(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, itemJSON{Value: json.RawMessage(value), Priority: priority})
+}
+
+func (s *Server) serveTake(w http.ResponseWriter, r *http.Request, name string, highest bool) {
+	wait := time.Duration(0)
+
+	if param := r.URL.Query().Get("wait"); param != "" {
+		d, err := time.ParseDuration(param)
+		if err != nil || d < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("server: wait must be a positive duration such as 5s"))
+			return
+		}
+
+		wait = d
+		if wait > s.MaxWait {
+			wait = s.MaxWait
+		}
+	}
+
+	env, err := s.take(r.Context(), name, highest, wait)
+	if err != nil {
+		writeError(w, status(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, itemJSON{Value: json.RawMessage(env.Value.(string)), Priority: env.Priority})
+}
+
+func (s *Server) servePeek(w http.ResponseWriter, h *hosted, highest bool) {
+	var value interface{}
+	var err error
+	h.do(func(q *spq.ShuffledPriorityQueue) {
+		if highest {
+			value, err = q.TryLast()
+		} else {
+			value, err = q.TryFirst()
+		}
+	})
+
+	if err != nil {
+		writeError(w, status(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, itemJSON{Value: json.RawMessage(value.(string))})
+}
+
+func (s *Server) serveStats(w http.ResponseWriter, h *hosted) {
+	stats := statsJSON{Priorities: []priorityJSON{}}
+
+	h.do(func(q *spq.ShuffledPriorityQueue) {
+		stats.Length = q.Len()
+		stats.Closed = q.Closed()
+
+		for _, priority := range q.Priorities() {
+			stats.Priorities = append(stats.Priorities, priorityJSON{
+				Priority: priority,
+				Count:    q.CountRange(priority, priority)})
+		}
+	})
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// Splits an escaped path of the form /queues/{name}/{endpoint}. Names may hold escaped slashes.
+func route(path string) (string, string, bool) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+
+	if len(parts) != 3 || parts[0] != "queues" || parts[1] == "" {
+		return "", "", false
+	}
+
+	name, err := url.PathUnescape(parts[1])
+	if err != nil {
+		return "", "", false
+	}
+
+	return name, parts[2], true
+}
+
+// Returns the compact form of the value query parameter or answers with an error.
+func queryValue(w http.ResponseWriter, r *http.Request) (string, bool) {
+	param, ok := r.URL.Query()["value"]
+
+	if !ok {
+		writeError(w, http.StatusBadRequest, errors.New("server: missing value"))
+		return "", false
+	}
+
+	value, err := canonical([]byte(param[0]))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return "", false
+	}
+
+	return value, true
+}
+
+// Returns the HTTP status for an error of the queue.
+func status(err error) int {
+	switch err {
+	case spq.ErrEmpty, spq.ErrNotFound:
+		return http.StatusNotFound
+	case spq.ErrClosed, spq.ErrFull:
+		return http.StatusConflict
+	case spq.ErrRateLimited:
+		return http.StatusTooManyRequests
+	case context.Canceled, context.DeadlineExceeded:
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusInternalServerError
+}
+
+func allowed(method string, methods []string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, errorJSON{Error: err.Error()})
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errors.New("server: method not allowed"))
+}
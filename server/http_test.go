@@ -0,0 +1,246 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	spq "github.com/theodesp/go-shuffled-queue"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type ServerSuite struct {
+	server *Server
+	http   *httptest.Server
+}
+
+var _ = Suite(&ServerSuite{})
+
+func (s *ServerSuite) SetUpTest(c *C) {
+	s.server = NewServer()
+	s.server.NewQueue = func(name string) *spq.ShuffledPriorityQueue {
+		q := spq.NewSPQ()
+		q.SetTieBreaker(spq.NewFIFOTieBreaker())
+		return q
+	}
+	s.http = httptest.NewServer(s.server)
+}
+
+func (s *ServerSuite) TearDownTest(c *C) {
+	s.http.Close()
+}
+
+// Sends a request and returns the status code and the decoded JSON response.
+func (s *ServerSuite) do(c *C, method, path, body string) (int, map[string]interface{}) {
+	req, err := http.NewRequest(method, s.http.URL+path, strings.NewReader(body))
+	c.Assert(err, IsNil)
+
+	resp, err := http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+
+	var doc map[string]interface{}
+	c.Assert(json.Unmarshal(b, &doc), IsNil)
+
+	return resp.StatusCode, doc
+}
+
+func (s *ServerSuite) add(c *C, name, value string, priority int) {
+	code, _ := s.do(c, "POST", "/queues/"+name+"/items", `{"value": `+value+`, "priority": `+jsonInt(priority)+`}`)
+	c.Assert(code, Equals, http.StatusCreated)
+}
+
+func jsonInt(i int) string {
+	b, _ := json.Marshal(i)
+	return string(b)
+}
+
+// Test adding then popping and shifting items in priority order.
+func (s *ServerSuite) TestAddPopShift(c *C) {
+	s.add(c, "jobs", `"hello"`, 1)
+	s.add(c, "jobs", `{"b": 1, "a": [1, 2]}`, 5)
+	s.add(c, "jobs", `12345678901234567890`, -2)
+
+	code, doc := s.do(c, "POST", "/queues/jobs/pop", "")
+	c.Assert(code, Equals, http.StatusOK)
+	c.Assert(doc["value"], DeepEquals, map[string]interface{}{"a": []interface{}{1.0, 2.0}, "b": 1.0})
+	c.Assert(doc["priority"], Equals, 5.0)
+
+	req, _ := http.NewRequest("POST", s.http.URL+"/queues/jobs/shift", nil)
+	resp, err := http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	c.Assert(string(b), Equals, `{"value":12345678901234567890,"priority":-2}`+"\n")
+
+	code, doc = s.do(c, "POST", "/queues/jobs/pop", "")
+	c.Assert(doc["value"], Equals, "hello")
+
+	code, doc = s.do(c, "POST", "/queues/jobs/pop", "")
+	c.Assert(code, Equals, http.StatusNotFound)
+	c.Assert(doc["error"], Equals, spq.ErrEmpty.Error())
+}
+
+// Test queues with different names are independent.
+func (s *ServerSuite) TestNamedQueues(c *C) {
+	s.add(c, "a", `"hello"`, 1)
+
+	code, _ := s.do(c, "POST", "/queues/b/pop", "")
+	c.Assert(code, Equals, http.StatusNotFound)
+
+	code, _ = s.do(c, "POST", "/queues/a/pop", "")
+	c.Assert(code, Equals, http.StatusOK)
+}
+
+// Test peeking, finding and removing items.
+func (s *ServerSuite) TestPeekFindRemove(c *C) {
+	s.add(c, "q", `"hello"`, 1)
+	s.add(c, "q", `"world"`, 3)
+
+	_, doc := s.do(c, "GET", "/queues/q/first", "")
+	c.Assert(doc["value"], Equals, "hello")
+	_, doc = s.do(c, "GET", "/queues/q/last", "")
+	c.Assert(doc["value"], Equals, "world")
+
+	value := url.QueryEscape(`"world"`)
+	code, doc := s.do(c, "GET", "/queues/q/priority?value="+value, "")
+	c.Assert(code, Equals, http.StatusOK)
+	c.Assert(doc["priority"], Equals, 3.0)
+
+	code, _ = s.do(c, "DELETE", "/queues/q/items?value="+value, "")
+	c.Assert(code, Equals, http.StatusOK)
+	code, doc = s.do(c, "DELETE", "/queues/q/items?value="+value, "")
+	c.Assert(code, Equals, http.StatusNotFound)
+	c.Assert(doc["error"], Equals, spq.ErrNotFound.Error())
+
+	code, _ = s.do(c, "GET", "/queues/q/priority?value="+value, "")
+	c.Assert(code, Equals, http.StatusNotFound)
+}
+
+// Test stats report the number of items of every priority.
+func (s *ServerSuite) TestStats(c *C) {
+	s.add(c, "q", `"hello"`, 1)
+	s.add(c, "q", `"world"`, 1)
+	s.add(c, "q", `"welt"`, 4)
+
+	code, doc := s.do(c, "GET", "/queues/q/stats", "")
+	c.Assert(code, Equals, http.StatusOK)
+	c.Assert(doc["length"], Equals, 3.0)
+	c.Assert(doc["closed"], Equals, false)
+	c.Assert(doc["priorities"], DeepEquals, []interface{}{
+		map[string]interface{}{"priority": 1.0, "count": 2.0},
+		map[string]interface{}{"priority": 4.0, "count": 1.0}})
+}
+
+// Test a blocking pop waits for an item to be added.
+func (s *ServerSuite) TestBlockingPop(c *C) {
+	done := make(chan map[string]interface{})
+
+	go func() {
+		_, doc := s.do(c, "POST", "/queues/q/pop?wait=5s", "")
+		done <- doc
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	s.add(c, "q", `"hello"`, 1)
+
+	select {
+	case doc := <-done:
+		c.Assert(doc["value"], Equals, "hello")
+	case <-time.After(5 * time.Second):
+		c.Fatal("blocking pop did not return")
+	}
+}
+
+// Test a blocking pop gives up after waiting, capped by MaxWait.
+func (s *ServerSuite) TestBlockingPopTimeout(c *C) {
+	s.server.MaxWait = 20 * time.Millisecond
+
+	start := time.Now()
+	code, _ := s.do(c, "POST", "/queues/q/shift?wait=1h", "")
+	c.Assert(code, Equals, http.StatusNotFound)
+	c.Assert(time.Since(start) < time.Second, Equals, true)
+}
+
+// Test errors of the queue and of the requests are answered with an error status.
+func (s *ServerSuite) TestErrors(c *C) {
+	s.server.NewQueue = func(name string) *spq.ShuffledPriorityQueue {
+		q := spq.NewSPQ()
+		q.SetCapacity(1)
+		return q
+	}
+	s.add(c, "q", `"hello"`, 1)
+
+	code, doc := s.do(c, "POST", "/queues/q/items", `{"value": "world"}`)
+	c.Assert(code, Equals, http.StatusConflict)
+	c.Assert(doc["error"], Equals, spq.ErrFull.Error())
+
+	code, _ = s.do(c, "POST", "/queues/q/items", `{"priority": 1}`)
+	c.Assert(code, Equals, http.StatusBadRequest)
+	code, _ = s.do(c, "POST", "/queues/q/items", `{"value": }`)
+	c.Assert(code, Equals, http.StatusBadRequest)
+	code, _ = s.do(c, "GET", "/queues/q/priority", "")
+	c.Assert(code, Equals, http.StatusBadRequest)
+	code, _ = s.do(c, "POST", "/queues/q/pop?wait=soon", "")
+	c.Assert(code, Equals, http.StatusBadRequest)
+	code, _ = s.do(c, "GET", "/queues/q/pop", "")
+	c.Assert(code, Equals, http.StatusMethodNotAllowed)
+	code, _ = s.do(c, "GET", "/queues/q", "")
+	c.Assert(code, Equals, http.StatusNotFound)
+	code, _ = s.do(c, "GET", "/queues/q/nothing", "")
+	c.Assert(code, Equals, http.StatusNotFound)
+}
+
+// Test only adding creates a queue.
+func (s *ServerSuite) TestMissingQueues(c *C) {
+	for _, request := range [][2]string{
+		{"GET", "/queues/a/stats"},
+		{"GET", "/queues/b/first"},
+		{"GET", "/queues/c/priority?value=1"},
+		{"DELETE", "/queues/d/items?value=1"},
+		{"POST", "/queues/e/pop"},
+		{"GET", "/queues/f/nothing"},
+		{"PUT", "/queues/g/items"}} {
+		s.do(c, request[0], request[1], "")
+	}
+
+	code, doc := s.do(c, "GET", "/queues/a/stats", "")
+	c.Assert(code, Equals, http.StatusOK)
+	c.Assert(doc["length"], Equals, 0.0)
+	c.Assert(s.server.queues, HasLen, 0)
+
+	s.add(c, "q", `"hello"`, 1)
+	c.Assert(s.server.queues, HasLen, 1)
+}
+
+// Test popping from a queue whose items are all rate limited is answered with too many requests.
+func (s *ServerSuite) TestRateLimited(c *C) {
+	s.server.NewQueue = func(name string) *spq.ShuffledPriorityQueue {
+		q := spq.NewSPQ()
+		q.SetRateLimit(1, 0.001, 1)
+		return q
+	}
+	s.add(c, "q", `"hello"`, 1)
+	s.add(c, "q", `"world"`, 1)
+
+	code, _ := s.do(c, "POST", "/queues/q/pop", "")
+	c.Assert(code, Equals, http.StatusOK)
+
+	code, doc := s.do(c, "POST", "/queues/q/pop?wait=20ms", "")
+	c.Assert(code, Equals, http.StatusTooManyRequests)
+	c.Assert(doc["error"], Equals, spq.ErrRateLimited.Error())
+}
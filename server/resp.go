@@ -0,0 +1,321 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	spq "github.com/theodesp/go-shuffled-queue"
+)
+
+// The largest bulk string or array accepted in a RESP command.
+const maxRESPLength = 1 << 20
+
+// The most bytes read for a single RESP command, whether sent as an array or inline.
+const maxRESPCommand = 4 << 20
+
+// Returned for malformed RESP commands.
+var errProtocol = errors.New("ERR protocol error")
+
+// Accepts connections on the listener and serves a subset of the Redis protocol on every one of them:
+//
+//	SPQ.ADD key priority member   adds the member, replies 1 if it was added or 0 if it already existed
+//	SPQ.POP key                   removes the highest priority member, replies [member, priority] or nil
+//	SPQ.SHIFT key                 removes the lowest priority member, replies [member, priority] or nil
+//	SPQ.BPOP key timeout          like SPQ.POP but waits up to timeout seconds for a member, 0 waits MaxWait
+//	SPQ.REM key member            removes the member, replies 1 if it was removed or 0 if it was not found
+//	SPQ.PRIO key member           replies the lowest priority of the member or nil
+//	SPQ.LEN key                   replies the number of members
+//
+// along with PING and QUIT. Keys are queue names shared with the HTTP API, members are stored as JSON strings
+// and members added over HTTP that are not strings are replied as JSON text.
+// Returns the error of the listener once it stops accepting connections.
+func (s *Server) ServeRESP(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go s.serveRESPConn(conn)
+	}
+}
+
+func (s *Server) serveRESPConn(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+
+	for {
+		args, err := readCommand(r)
+
+		if err == errProtocol {
+			writeRESPError(w, err)
+			w.Flush()
+			return
+		}
+
+		if err != nil {
+			return
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		quit := strings.ToUpper(args[0]) == "QUIT"
+		if quit {
+			w.WriteString("+OK\r\n")
+		} else if strings.ToUpper(args[0]) == "SPQ.BPOP" {
+			s.executeWatching(conn, r, w, args)
+		} else {
+			s.execute(context.Background(), w, args)
+		}
+
+		if err := w.Flush(); err != nil || quit {
+			return
+		}
+	}
+}
+
+// Runs a blocking command, cancelling it if the client hangs up while it waits.
+func (s *Server) executeWatching(conn net.Conn, r *bufio.Reader, w *bufio.Writer, args []string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+
+		// Peek returns once the client sends more or hangs up, leaving what it sent to the next command
+		if _, err := r.Peek(1); err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+			cancel()
+		}
+	}()
+
+	s.execute(ctx, w, args)
+
+	// Interrupt the watch before reading the next command
+	conn.SetReadDeadline(time.Now())
+	<-watched
+	conn.SetReadDeadline(time.Time{})
+}
+
+// Runs a command and writes its reply. Blocking commands stop waiting once the context is done.
+func (s *Server) execute(ctx context.Context, w *bufio.Writer, args []string) {
+	name := strings.ToUpper(args[0])
+	arity := map[string]int{
+		"PING":      1,
+		"SPQ.ADD":   4,
+		"SPQ.POP":   2,
+		"SPQ.SHIFT": 2,
+		"SPQ.BPOP":  3,
+		"SPQ.REM":   3,
+		"SPQ.PRIO":  3,
+		"SPQ.LEN":   2}
+
+	n, ok := arity[name]
+	if !ok {
+		writeRESPError(w, fmt.Errorf("ERR unknown command '%s'", args[0]))
+		return
+	}
+
+	if len(args) != n {
+		writeRESPError(w, fmt.Errorf("ERR wrong number of arguments for '%s' command", args[0]))
+		return
+	}
+
+	if name == "PING" {
+		w.WriteString("+PONG\r\n")
+		return
+	}
+
+	// Only adding creates a queue, the other commands answer for a missing queue as for an empty one
+	h := s.existing(args[1])
+
+	switch name {
+	case "SPQ.ADD":
+		priority, err := strconv.Atoi(args[2])
+		if err != nil {
+			writeRESPError(w, errors.New("ERR priority is not an integer"))
+			return
+		}
+
+		added, err := s.queue(args[1]).add(memberValue(args[3]), priority)
+		if err != nil {
+			writeRESPError(w, fmt.Errorf("ERR %v", err))
+			return
+		}
+
+		if added {
+			writeInteger(w, 1)
+		} else {
+			writeInteger(w, 0)
+		}
+	case "SPQ.POP", "SPQ.SHIFT", "SPQ.BPOP":
+		wait := time.Duration(0)
+
+		if name == "SPQ.BPOP" {
+			seconds, err := strconv.ParseFloat(args[2], 64)
+			if err != nil || seconds < 0 {
+				writeRESPError(w, errors.New("ERR timeout is not a positive number"))
+				return
+			}
+
+			wait = time.Duration(seconds * float64(time.Second))
+			if wait == 0 || wait > s.MaxWait {
+				wait = s.MaxWait
+			}
+		}
+
+		env, err := s.take(ctx, args[1], name != "SPQ.SHIFT", wait)
+
+		switch err {
+		case nil:
+			w.WriteString("*2\r\n")
+			writeBulk(w, member(env.Value.(string)))
+			writeBulk(w, strconv.Itoa(env.Priority))
+		case spq.ErrEmpty, spq.ErrClosed:
+			w.WriteString("*-1\r\n")
+		default:
+			writeRESPError(w, fmt.Errorf("ERR %v", err))
+		}
+	case "SPQ.REM":
+		h.do(func(q *spq.ShuffledPriorityQueue) {
+			if q.Remove(memberValue(args[2])) {
+				writeInteger(w, 1)
+			} else {
+				writeInteger(w, 0)
+			}
+		})
+	case "SPQ.PRIO":
+		h.do(func(q *spq.ShuffledPriorityQueue) {
+			if priority, ok := q.FindPriority(memberValue(args[2])); ok {
+				writeInteger(w, priority)
+			} else {
+				w.WriteString("$-1\r\n")
+			}
+		})
+	case "SPQ.LEN":
+		h.do(func(q *spq.ShuffledPriorityQueue) {
+			writeInteger(w, q.Len())
+		})
+	}
+}
+
+// Reads a command sent either as an array of bulk strings or inline, reading at most maxRESPCommand bytes.
+// Null and empty arrays are read as empty commands.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	left := maxRESPCommand
+
+	line, err := readLine(r, &left)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < -1 || n > maxRESPLength {
+		return nil, errProtocol
+	}
+
+	// Grown as arguments are read so that the length announced cannot allocate more than the bytes sent
+	args := []string{}
+
+	for i := 0; i < n; i += 1 {
+		line, err := readLine(r, &left)
+		if err != nil {
+			return nil, err
+		}
+
+		if !strings.HasPrefix(line, "$") {
+			return nil, errProtocol
+		}
+
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxRESPLength || size+2 > left {
+			return nil, errProtocol
+		}
+		left -= size + 2
+
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+
+		if string(b[size:]) != "\r\n" {
+			return nil, errProtocol
+		}
+
+		args = append(args, string(b[:size]))
+	}
+
+	return args, nil
+}
+
+// Reads a line ending with CRLF or LF and returns it without its ending.
+// Returns errProtocol if the line is longer than the bytes left, which it takes from.
+func readLine(r *bufio.Reader, left *int) (string, error) {
+	var line []byte
+
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > *left {
+			return "", errProtocol
+		}
+		line = append(line, chunk...)
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		break
+	}
+
+	*left -= len(line)
+	return strings.TrimSuffix(strings.TrimSuffix(string(line), "\n"), "\r"), nil
+}
+
+// Returns the queue item of a member, the member as a JSON string.
+func memberValue(m string) string {
+	b, _ := json.Marshal(m)
+	return string(b)
+}
+
+// Returns the member of a queue item, the string it holds or its JSON text if it is not a string.
+func member(value string) string {
+	var m string
+
+	if err := json.Unmarshal([]byte(value), &m); err != nil {
+		return value
+	}
+
+	return m
+}
+
+func writeBulk(w *bufio.Writer, s string) {
+	fmt.Fprintf(w, "$%d\r\n%s\r\n", len(s), s)
+}
+
+func writeInteger(w *bufio.Writer, i int) {
+	fmt.Fprintf(w, ":%d\r\n", i)
+}
+
+func writeRESPError(w *bufio.Writer, err error) {
+	fmt.Fprintf(w, "-%s\r\n", strings.ReplaceAll(err.Error(), "\r\n", " "))
+}
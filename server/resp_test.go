@@ -0,0 +1,240 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	spq "github.com/theodesp/go-shuffled-queue"
+)
+
+type RESPSuite struct {
+	server   *Server
+	listener net.Listener
+}
+
+var _ = Suite(&RESPSuite{})
+
+func (s *RESPSuite) SetUpTest(c *C) {
+	s.server = NewServer()
+	s.server.NewQueue = func(name string) *spq.ShuffledPriorityQueue {
+		q := spq.NewSPQ()
+		q.SetTieBreaker(spq.NewFIFOTieBreaker())
+		return q
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	s.listener = l
+
+	go s.server.ServeRESP(l)
+}
+
+func (s *RESPSuite) TearDownTest(c *C) {
+	s.listener.Close()
+}
+
+// A connection sending commands as arrays of bulk strings, like client libraries do.
+type respConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (s *RESPSuite) dial(c *C) *respConn {
+	conn, err := net.Dial("tcp", s.listener.Addr().String())
+	c.Assert(err, IsNil)
+
+	return &respConn{Conn: conn, r: bufio.NewReader(conn)}
+}
+
+// Sends a command and returns its reply in a compact text form: arrays as [a b], nil as (nil).
+func (rc *respConn) do(c *C, args ...string) string {
+	fmt.Fprintf(rc, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(rc, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	return rc.reply(c)
+}
+
+func (rc *respConn) reply(c *C) string {
+	line, err := rc.r.ReadString('\n')
+	c.Assert(err, IsNil)
+	line = strings.TrimSuffix(line, "\r\n")
+
+	switch line[0] {
+	case '*':
+		var n int
+		fmt.Sscan(line[1:], &n)
+		if n < 0 {
+			return "(nil)"
+		}
+
+		items := []string{}
+		for i := 0; i < n; i += 1 {
+			items = append(items, rc.reply(c))
+		}
+		return "[" + strings.Join(items, " ") + "]"
+	case '$':
+		var n int
+		fmt.Sscan(line[1:], &n)
+		if n < 0 {
+			return "(nil)"
+		}
+
+		b := make([]byte, n+2)
+		_, err := io.ReadFull(rc.r, b)
+		c.Assert(err, IsNil)
+		return string(b[:n])
+	}
+
+	return line
+}
+
+// Test adding, popping and shifting members.
+func (s *RESPSuite) TestAddPopShift(c *C) {
+	conn := s.dial(c)
+	defer conn.Close()
+
+	c.Assert(conn.do(c, "SPQ.ADD", "jobs", "1", "hello"), Equals, ":1")
+	c.Assert(conn.do(c, "SPQ.ADD", "jobs", "1", "hello"), Equals, ":0")
+	c.Assert(conn.do(c, "spq.add", "jobs", "5", "hello world"), Equals, ":1")
+	c.Assert(conn.do(c, "SPQ.ADD", "jobs", "-2", "welt"), Equals, ":1")
+	c.Assert(conn.do(c, "SPQ.LEN", "jobs"), Equals, ":3")
+
+	c.Assert(conn.do(c, "SPQ.POP", "jobs"), Equals, "[hello world 5]")
+	c.Assert(conn.do(c, "SPQ.SHIFT", "jobs"), Equals, "[welt -2]")
+	c.Assert(conn.do(c, "SPQ.POP", "jobs"), Equals, "[hello 1]")
+	c.Assert(conn.do(c, "SPQ.POP", "jobs"), Equals, "(nil)")
+	c.Assert(conn.do(c, "SPQ.LEN", "jobs"), Equals, ":0")
+}
+
+// Test finding the priority of members and removing them.
+func (s *RESPSuite) TestRemPrio(c *C) {
+	conn := s.dial(c)
+	defer conn.Close()
+
+	conn.do(c, "SPQ.ADD", "q", "3", "hello")
+
+	c.Assert(conn.do(c, "SPQ.PRIO", "q", "hello"), Equals, ":3")
+	c.Assert(conn.do(c, "SPQ.REM", "q", "hello"), Equals, ":1")
+	c.Assert(conn.do(c, "SPQ.REM", "q", "hello"), Equals, ":0")
+	c.Assert(conn.do(c, "SPQ.PRIO", "q", "hello"), Equals, "(nil)")
+}
+
+// Test a blocking pop waits for a member added by another connection, or times out.
+func (s *RESPSuite) TestBPop(c *C) {
+	conn, other := s.dial(c), s.dial(c)
+	defer conn.Close()
+	defer other.Close()
+
+	c.Assert(conn.do(c, "SPQ.BPOP", "q", "0.02"), Equals, "(nil)")
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprintf(other, "*4\r\n$7\r\nSPQ.ADD\r\n$1\r\nq\r\n$1\r\n1\r\n$5\r\nhello\r\n")
+	}()
+
+	c.Assert(conn.do(c, "SPQ.BPOP", "q", "5"), Equals, "[hello 1]")
+}
+
+// Test inline commands, PING and QUIT as sent by a terminal.
+func (s *RESPSuite) TestInline(c *C) {
+	conn := s.dial(c)
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "PING\r\nSPQ.ADD q 2 hello\r\nSPQ.LEN q\r\nQUIT\r\n")
+
+	c.Assert(conn.reply(c), Equals, "+PONG")
+	c.Assert(conn.reply(c), Equals, ":1")
+	c.Assert(conn.reply(c), Equals, ":1")
+	c.Assert(conn.reply(c), Equals, "+OK")
+
+	_, err := conn.r.ReadString('\n')
+	c.Assert(err, NotNil)
+}
+
+// Test members are shared with the HTTP API.
+func (s *RESPSuite) TestSharedWithHTTP(c *C) {
+	conn := s.dial(c)
+	defer conn.Close()
+
+	h := s.server.queue("q")
+	h.add(`{"a":1}`, 1)
+	h.add(`"hello"`, 2)
+
+	c.Assert(conn.do(c, "SPQ.POP", "q"), Equals, "[hello 2]")
+	c.Assert(conn.do(c, "SPQ.POP", "q"), Equals, `[{"a":1} 1]`)
+}
+
+// Test errors are replied without closing the connection.
+func (s *RESPSuite) TestErrors(c *C) {
+	conn := s.dial(c)
+	defer conn.Close()
+
+	c.Assert(conn.do(c, "SPQ.ADD", "q", "high", "hello"), Equals, "-ERR priority is not an integer")
+	c.Assert(conn.do(c, "SPQ.POP"), Equals, "-ERR wrong number of arguments for 'SPQ.POP' command")
+	c.Assert(conn.do(c, "GET", "q"), Equals, "-ERR unknown command 'GET'")
+	c.Assert(conn.do(c, "SPQ.BPOP", "q", "-1"), Equals, "-ERR timeout is not a positive number")
+	c.Assert(conn.do(c, "PING"), Equals, "+PONG")
+}
+
+// Test null and empty arrays are ignored and malformed or oversized commands are rejected.
+func (s *RESPSuite) TestMalformed(c *C) {
+	conn := s.dial(c)
+	defer conn.Close()
+
+	fmt.Fprint(conn, "*-1\r\n*0\r\n")
+	c.Assert(conn.do(c, "PING"), Equals, "+PONG")
+
+	fmt.Fprint(conn, "*-2\r\n")
+	c.Assert(conn.reply(c), Equals, "-"+errProtocol.Error())
+
+	conn = s.dial(c)
+	defer conn.Close()
+
+	// The fourth argument goes over the bytes allowed per command and is rejected before being read
+	member := strings.Repeat("a", maxRESPLength)
+	fmt.Fprint(conn, "*5\r\n")
+	for i := 0; i < 3; i += 1 {
+		fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(member), member)
+	}
+	fmt.Fprintf(conn, "$%d\r\n", len(member))
+	c.Assert(conn.reply(c), Equals, "-"+errProtocol.Error())
+
+	conn = s.dial(c)
+	defer conn.Close()
+
+	fmt.Fprint(conn, strings.Repeat("a", maxRESPCommand)+"a\r\n")
+	c.Assert(conn.reply(c), Equals, "-"+errProtocol.Error())
+}
+
+// Test a blocking pop stops waiting once its client hangs up.
+func (s *RESPSuite) TestBPopHangUp(c *C) {
+	conn := s.dial(c)
+	fmt.Fprint(conn, "*3\r\n$8\r\nSPQ.BPOP\r\n$1\r\nq\r\n$2\r\n10\r\n")
+	time.Sleep(20 * time.Millisecond)
+	conn.Close()
+	time.Sleep(20 * time.Millisecond)
+
+	other := s.dial(c)
+	defer other.Close()
+
+	c.Assert(other.do(c, "SPQ.ADD", "q", "1", "hello"), Equals, ":1")
+	c.Assert(other.do(c, "SPQ.POP", "q"), Equals, "[hello 1]")
+}
+
+// Test commands pipelined behind a blocking pop are run once it returns.
+func (s *RESPSuite) TestBPopPipelined(c *C) {
+	conn := s.dial(c)
+	defer conn.Close()
+
+	fmt.Fprint(conn, "*3\r\n$8\r\nSPQ.BPOP\r\n$1\r\nq\r\n$4\r\n0.05\r\nPING\r\n")
+	c.Assert(conn.reply(c), Equals, "(nil)")
+	c.Assert(conn.reply(c), Equals, "+PONG")
+}
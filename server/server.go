@@ -0,0 +1,216 @@
+// Package server hosts named shuffled priority queues for clients written in any language.
+// Values are JSON documents, stored in their compact form so that equal documents are the same item.
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	spq "github.com/theodesp/go-shuffled-queue"
+)
+
+// The longest a blocking pop waits for an item unless told otherwise.
+const DefaultMaxWait = time.Minute
+
+// How often a blocking pop retries a queue whose items are all rate limited.
+const rateLimitPoll = 50 * time.Millisecond
+
+// A Server hosts named queues, creating them the first time an item is added to them.
+// Every queue is only used with its lock held so the server may be used from many goroutines.
+type Server struct {
+	// Creates the queue for a name used for the first time. Defaults to spq.NewSPQ.
+	NewQueue func(name string) *spq.ShuffledPriorityQueue
+	// The longest a blocking pop waits for an item. Defaults to DefaultMaxWait.
+	MaxWait time.Duration
+
+	// Created is closed and replaced every time a queue is created to wake up the blocking pops waiting for it.
+	mu      sync.Mutex
+	queues  map[string]*hosted
+	created chan struct{}
+}
+
+// A queue hosted by the server. Added is closed and replaced every time an item is added
+// to wake up the blocking pops.
+type hosted struct {
+	mu    sync.Mutex
+	queue *spq.ShuffledPriorityQueue
+	added chan struct{}
+}
+
+// Creates and returns a reference to a server hosting no queue yet.
+func NewServer() *Server {
+	s := Server{
+		MaxWait: DefaultMaxWait,
+		queues:  make(map[string]*hosted),
+		created: make(chan struct{})}
+
+	return &s
+}
+
+// Returns the queue with the specified name, creating it if needed.
+func (s *Server) queue(name string) *hosted {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if h, ok := s.queues[name]; ok {
+		return h
+	}
+
+	q := spq.NewSPQ()
+	if s.NewQueue != nil {
+		q = s.NewQueue(name)
+	}
+
+	h := &hosted{queue: q, added: make(chan struct{})}
+	s.queues[name] = h
+
+	close(s.created)
+	s.created = make(chan struct{})
+
+	return h
+}
+
+// Returns the queue with the specified name, or an empty queue that is not hosted if there is none,
+// so that reading a queue never creates it.
+func (s *Server) existing(name string) *hosted {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if h, ok := s.queues[name]; ok {
+		return h
+	}
+
+	return &hosted{queue: spq.NewSPQ(), added: make(chan struct{})}
+}
+
+// Removes the highest or the lowest priority value from the queue with the specified name.
+// When the queue is empty or does not exist yet waits up to wait for a value to be added.
+func (s *Server) take(ctx context.Context, name string, highest bool, wait time.Duration) (*spq.Envelope, error) {
+	var timeout <-chan time.Time
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		s.mu.Lock()
+		h, ok := s.queues[name]
+		created := s.created
+		s.mu.Unlock()
+
+		if ok {
+			return h.take(ctx, highest, timeout)
+		}
+
+		if timeout == nil {
+			return nil, spq.ErrEmpty
+		}
+
+		select {
+		case <-created:
+		case <-timeout:
+			return nil, spq.ErrEmpty
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Runs f with the queue lock held.
+func (h *hosted) do(f func(q *spq.ShuffledPriorityQueue)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	f(h.queue)
+}
+
+// Adds a value to the queue and wakes up the blocking pops.
+// Returns false if the value already existed with the same priority.
+func (h *hosted) add(value string, priority int) (bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	length := h.queue.Len()
+
+	if err := h.queue.TryAddPriority(value, priority); err != nil {
+		return false, err
+	}
+
+	close(h.added)
+	h.added = make(chan struct{})
+
+	return h.queue.Len() > length, nil
+}
+
+// Removes the highest or the lowest priority value from the queue. When the queue is empty or all of its values
+// are rate limited waits until the timeout fires for a value to be taken, or returns right away if it is nil.
+func (h *hosted) take(ctx context.Context, highest bool, timeout <-chan time.Time) (*spq.Envelope, error) {
+	takeEnvelope := h.queue.ShiftEnvelope
+	if highest {
+		takeEnvelope = h.queue.PopEnvelope
+	}
+
+	for {
+		h.mu.Lock()
+		env, ok := takeEnvelope()
+		closed := h.queue.Closed()
+		length := h.queue.Len()
+		added := h.added
+		h.mu.Unlock()
+
+		if ok {
+			return env, nil
+		}
+
+		if closed && length == 0 {
+			return nil, spq.ErrClosed
+		}
+
+		// Values left behind are waiting for a token of their rate limit
+		err := spq.ErrEmpty
+		var retry <-chan time.Time
+		if length > 0 {
+			err = spq.ErrRateLimited
+			retry = time.After(rateLimitPoll)
+		}
+
+		if timeout == nil {
+			return nil, err
+		}
+
+		select {
+		case <-added:
+		case <-retry:
+		case <-timeout:
+			return nil, err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Returns the compact form of a JSON document with sorted object keys, used as the queue item.
+// Numbers keep their text so that large integers are not rounded.
+func canonical(doc []byte) (string, error) {
+	var v interface{}
+
+	d := json.NewDecoder(bytes.NewReader(doc))
+	d.UseNumber()
+
+	if err := d.Decode(&v); err != nil {
+		return "", err
+	}
+
+	if d.More() {
+		return "", errors.New("server: trailing data after the JSON value")
+	}
+
+	b, err := json.Marshal(v)
+	return string(b), err
+}
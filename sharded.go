@@ -0,0 +1,409 @@
+package go_shuffled_queue
+
+import (
+	"hash/maphash"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+// A ShardedQueue spreads its items over independent shuffled priority queues, each with its own lock,
+// so that many goroutines can use it at once. An item always goes to the same shard.
+// Pop and Shift take an item from the overall highest or lowest priority, picking among the shards holding
+// that priority in proportion to how many items of that priority they hold, so that items of the same priority
+// still come out in a uniformly random order. In approximate mode Pop, Shift, First and Last only look at two
+// shards picked at random and use the better one, trading exactness for throughput.
+type ShardedQueue struct {
+	shards      []shard
+	seed        maphash.Seed
+	approximate int32
+
+	// Guards rand, which is nil when using the shared source of math/rand
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+var _ Queue = (*ShardedQueue)(nil)
+
+// How many times Pop and Shift choose a shard without locking before locking every shard to choose.
+const optimisticTakes = 3
+
+// A shard publishes the edges of its queue so that they can be compared without taking its lock.
+// They are only updated with the lock held.
+type shard struct {
+	mu  sync.Mutex
+	spq *ShuffledPriorityQueue
+
+	length      int64
+	top         int64
+	topCount    int64
+	bottom      int64
+	bottomCount int64
+
+	// Keeps shards on separate cache lines
+	_ [64]byte
+}
+
+// Creates and returns a reference to an empty queue spread over the specified number of shards.
+func NewShardedQueue(shards int) *ShardedQueue {
+	if shards < 1 {
+		shards = 1
+	}
+
+	sq := ShardedQueue{
+		shards: make([]shard, shards),
+		seed:   maphash.MakeSeed()}
+
+	for i := range sq.shards {
+		sq.shards[i].spq = NewSPQ()
+	}
+
+	return &sq
+}
+
+// Sets whether Pop and Shift only compare two shards picked at random instead of all of them.
+func (sq *ShardedQueue) SetApproximate(approximate bool) {
+	if approximate {
+		atomic.StoreInt32(&sq.approximate, 1)
+	} else {
+		atomic.StoreInt32(&sq.approximate, 0)
+	}
+}
+
+// Sets the source of the random choices between shards and of the tie breakers of the shards, which are seeded
+// from it. If src is nil the shared source of math/rand and time seeded tie breakers are used. Items are still spread
+// over the shards by a hash seeded at random, so orders are only reproducible with a single shard.
+// Must not be called while the queue is in use by other goroutines.
+func (sq *ShardedQueue) SetRandSource(src rand.Source) {
+	for i := range sq.shards {
+		s := &sq.shards[i]
+
+		var tb rand.Source
+		if src != nil {
+			tb = rand.NewSource(src.Int63())
+		}
+
+		s.mu.Lock()
+		s.spq.SetTieBreaker(NewRandomTieBreaker(tb))
+		s.mu.Unlock()
+	}
+
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+
+	if src == nil {
+		sq.rand = nil
+		return
+	}
+
+	sq.rand = rand.New(src)
+}
+
+// Adds an item to the priority queue using the default priority.
+// Returns the value added.
+func (sq *ShardedQueue) Add(v interface{}) interface{} {
+	return sq.AddPriority(v, DefaultPriority)
+}
+
+// Adds an item to the priority queue using a specified priority.
+// Returns the value added. Items that cannot be added are dropped, see TryAddPriority.
+func (sq *ShardedQueue) AddPriority(v interface{}, priority int) interface{} {
+	sq.TryAddPriority(v, priority)
+	return v
+}
+
+// Adds an item to the priority queue using a specified priority.
+// Returns ErrUnhashable if the item cannot be stored.
+func (sq *ShardedQueue) TryAddPriority(v interface{}, priority int) error {
+	s, ok := sq.shardOf(v)
+	if !ok {
+		return ErrUnhashable
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.spq.TryAddPriority(v, priority)
+	s.publish()
+
+	return err
+}
+
+// Remove the item from the queue if exists.
+// Returns true if item was removed or false if the item was not found.
+func (sq *ShardedQueue) Remove(v interface{}) bool {
+	s, ok := sq.shardOf(v)
+	if !ok {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := s.spq.Remove(v)
+	s.publish()
+
+	return removed
+}
+
+// Returns the lowest priority of the item.
+// Returns true if found otherwise false.
+func (sq *ShardedQueue) FindPriority(v interface{}) (int, bool) {
+	s, ok := sq.shardOf(v)
+	if !ok {
+		return -1, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.spq.FindPriority(v)
+}
+
+// Removes and returns an item of the highest priority.
+// Returns true if found otherwise false.
+func (sq *ShardedQueue) Pop() (interface{}, bool) {
+	return sq.take(true, (*ShuffledPriorityQueue).Pop)
+}
+
+// Removes and returns an item of the lowest priority.
+// Returns true if found otherwise false.
+func (sq *ShardedQueue) Shift() (interface{}, bool) {
+	return sq.take(false, (*ShuffledPriorityQueue).Shift)
+}
+
+// Returns an item of the lowest priority without removing it.
+// Returns true if found otherwise false.
+func (sq *ShardedQueue) First() (interface{}, bool) {
+	return sq.take(false, (*ShuffledPriorityQueue).First)
+}
+
+// Returns an item of the highest priority without removing it.
+// Returns true if found otherwise false.
+func (sq *ShardedQueue) Last() (interface{}, bool) {
+	return sq.take(true, (*ShuffledPriorityQueue).Last)
+}
+
+// Returns the number of items in the queue.
+func (sq *ShardedQueue) Len() int {
+	length := int64(0)
+
+	for i := range sq.shards {
+		length += atomic.LoadInt64(&sq.shards[i].length)
+	}
+
+	return int(length)
+}
+
+// Returns the shard of an item or false if the item cannot be hashed.
+func (sq *ShardedQueue) shardOf(v interface{}) (s *shard, ok bool) {
+	defer func() {
+		if recover() != nil {
+			s, ok = nil, false
+		}
+	}()
+
+	h := maphash.Comparable(sq.seed, v)
+	return &sq.shards[h%uint64(len(sq.shards))], true
+}
+
+// Runs f on the shard holding the highest or the lowest priority. Shards may change between choosing one and
+// taking its lock, after a few such races the choice is made again with every shard locked.
+func (sq *ShardedQueue) take(highest bool, f func(*ShuffledPriorityQueue) (interface{}, bool)) (interface{}, bool) {
+	if atomic.LoadInt32(&sq.approximate) == 1 {
+		if v, ok := sq.takeApproximate(highest, f); ok {
+			return v, true
+		}
+	}
+
+	for attempt := 0; attempt < optimisticTakes; attempt += 1 {
+		s, edge := sq.choose(highest, (*shard).published)
+		if s == nil {
+			if sq.Len() == 0 {
+				return nil, false
+			}
+			break
+		}
+
+		s.mu.Lock()
+		if s.spq.Len() > 0 && s.edge(highest) == edge {
+			v, ok := f(s.spq)
+			s.publish()
+			s.mu.Unlock()
+
+			return v, ok
+		}
+		s.mu.Unlock()
+	}
+
+	return sq.takeLocked(highest, f)
+}
+
+// Runs f on the shard holding the highest or the lowest priority chosen with every shard locked,
+// so that no other goroutine can change them in between. Returns false if every shard is empty.
+func (sq *ShardedQueue) takeLocked(highest bool, f func(*ShuffledPriorityQueue) (interface{}, bool)) (interface{}, bool) {
+	for i := range sq.shards {
+		sq.shards[i].mu.Lock()
+	}
+	defer func() {
+		for i := range sq.shards {
+			sq.shards[i].mu.Unlock()
+		}
+	}()
+
+	s, _ := sq.choose(highest, (*shard).current)
+	if s == nil {
+		return nil, false
+	}
+
+	v, ok := f(s.spq)
+	s.publish()
+
+	return v, ok
+}
+
+// Runs f on the better of two shards picked at random.
+// Returns false if both are empty.
+func (sq *ShardedQueue) takeApproximate(highest bool, f func(*ShuffledPriorityQueue) (interface{}, bool)) (interface{}, bool) {
+	a, b := &sq.shards[sq.intn(len(sq.shards))], &sq.shards[sq.intn(len(sq.shards))]
+
+	if atomic.LoadInt64(&b.length) > 0 &&
+		(atomic.LoadInt64(&a.length) == 0 || better(b.loadEdge(highest), a.loadEdge(highest), highest)) {
+		a = b
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.spq.Len() == 0 {
+		return nil, false
+	}
+
+	v, ok := f(a.spq)
+	a.publish()
+
+	return v, ok
+}
+
+// Returns a shard holding the highest or the lowest priority along with that priority, picking among the shards
+// holding it in proportion to how many items of that priority they hold. The edge of every shard and its number of
+// items are given by view. Returns nil if every shard is empty.
+func (sq *ShardedQueue) choose(highest bool, view func(s *shard, highest bool) (int64, int64, bool)) (*shard, int64) {
+	var edge, total int64
+	found := false
+
+	for i := range sq.shards {
+		e, count, ok := view(&sq.shards[i], highest)
+		if !ok {
+			continue
+		}
+
+		if !found || better(e, edge, highest) {
+			edge, total, found = e, count, true
+		} else if e == edge {
+			total += count
+		}
+	}
+
+	if !found {
+		return nil, 0
+	}
+
+	// Published shards may have changed since, take returns here if the chosen one no longer holds the edge
+	r := int64(sq.intn(int(total)))
+	for i := range sq.shards {
+		s := &sq.shards[i]
+		e, count, ok := view(s, highest)
+		if !ok || e != edge {
+			continue
+		}
+
+		if r -= count; r < 0 {
+			return s, edge
+		}
+	}
+
+	return nil, edge
+}
+
+// Returns a random number in [0, n), or 0 if n is not positive.
+func (sq *ShardedQueue) intn(n int) int {
+	if n <= 1 {
+		return 0
+	}
+
+	if sq.rand == nil {
+		return rand.Intn(n)
+	}
+
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+
+	return sq.rand.Intn(n)
+}
+
+// Returns true if the priority a comes before b.
+func better(a, b int64, highest bool) bool {
+	if highest {
+		return a > b
+	}
+	return a < b
+}
+
+// Publishes the length and the edges of the shard queue. Must be called with the lock held.
+func (s *shard) publish() {
+	keys := s.spq.keys
+	atomic.StoreInt64(&s.length, int64(s.spq.length))
+
+	if len(keys) == 0 {
+		return
+	}
+
+	top, bottom := keys[len(keys)-1], keys[0]
+	atomic.StoreInt64(&s.top, int64(top))
+	atomic.StoreInt64(&s.topCount, int64(s.spq.priorities[top].size))
+	atomic.StoreInt64(&s.bottom, int64(bottom))
+	atomic.StoreInt64(&s.bottomCount, int64(s.spq.priorities[bottom].size))
+}
+
+// Returns the highest or the lowest priority of the shard queue. Must be called with the lock held.
+func (s *shard) edge(highest bool) int64 {
+	if highest {
+		return int64(s.spq.keys[len(s.spq.keys)-1])
+	}
+	return int64(s.spq.keys[0])
+}
+
+func (s *shard) loadEdge(highest bool) int64 {
+	if highest {
+		return atomic.LoadInt64(&s.top)
+	}
+	return atomic.LoadInt64(&s.bottom)
+}
+
+func (s *shard) loadEdgeCount(highest bool) int64 {
+	if highest {
+		return atomic.LoadInt64(&s.topCount)
+	}
+	return atomic.LoadInt64(&s.bottomCount)
+}
+
+// Returns the published edge of the shard with its number of items, or false if the shard is empty.
+func (s *shard) published(highest bool) (int64, int64, bool) {
+	if atomic.LoadInt64(&s.length) == 0 {
+		return 0, 0, false
+	}
+
+	return s.loadEdge(highest), s.loadEdgeCount(highest), true
+}
+
+// Returns the edge of the shard queue with its number of items, or false if the shard is empty.
+// Must be called with the lock held.
+func (s *shard) current(highest bool) (int64, int64, bool) {
+	if s.spq.Len() == 0 {
+		return 0, 0, false
+	}
+
+	edge := s.edge(highest)
+	return edge, int64(s.spq.priorities[int(edge)].size), true
+}
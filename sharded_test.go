@@ -0,0 +1,230 @@
+package go_shuffled_queue
+
+import (
+	"math/rand"
+	"runtime"
+	"sync"
+
+	"github.com/theodesp/go-shuffled-queue/fairness"
+	. "gopkg.in/check.v1"
+)
+
+// Test a sharded queue pops from the overall highest priority and shifts from the overall lowest one.
+func (s *MySuite) TestShardedQueueOrder(c *C) {
+	sq := NewShardedQueue(4)
+	sq.SetRandSource(rand.NewSource(1))
+
+	for i := 0; i < 100; i += 1 {
+		sq.AddPriority(i, i)
+	}
+	c.Assert(sq.Len(), Equals, 100)
+
+	item, ok := sq.Last()
+	c.Assert(ok, Equals, true)
+	c.Assert(item, Equals, 99)
+	item, ok = sq.First()
+	c.Assert(ok, Equals, true)
+	c.Assert(item, Equals, 0)
+
+	for i := 99; i >= 50; i -= 1 {
+		item, ok := sq.Pop()
+		c.Assert(ok, Equals, true)
+		c.Assert(item, Equals, i)
+	}
+	for i := 0; i < 50; i += 1 {
+		item, ok := sq.Shift()
+		c.Assert(ok, Equals, true)
+		c.Assert(item, Equals, i)
+	}
+
+	_, ok = sq.Pop()
+	c.Assert(ok, Equals, false)
+	c.Assert(sq.Len(), Equals, 0)
+}
+
+// Test a sharded queue finds, removes and rejects items like a single queue.
+func (s *MySuite) TestShardedQueueItems(c *C) {
+	sq := NewShardedQueue(3)
+
+	sq.AddPriority("hello", 2)
+	sq.AddPriority("hello", 5)
+	sq.Add("world")
+
+	priority, ok := sq.FindPriority("hello")
+	c.Assert(ok, Equals, true)
+	c.Assert(priority, Equals, 2)
+
+	c.Assert(sq.Remove("hello"), Equals, true)
+	priority, ok = sq.FindPriority("hello")
+	c.Assert(ok, Equals, true)
+	c.Assert(priority, Equals, 5)
+
+	c.Assert(sq.Remove("hello"), Equals, true)
+	c.Assert(sq.Remove("hello"), Equals, false)
+	priority, ok = sq.FindPriority("hello")
+	c.Assert(ok, Equals, false)
+	c.Assert(priority, Equals, -1)
+
+	c.Assert(sq.TryAddPriority([]int{1}, 1), Equals, ErrUnhashable)
+	c.Assert(sq.Remove([]int{1}), Equals, false)
+	c.Assert(sq.Len(), Equals, 1)
+}
+
+// Test items with the same priority spread over shards are popped in a uniformly random order.
+func (s *MySuite) TestShardedQueuePopFairness(c *C) {
+	positions := make([][]int, 4)
+	for i := range positions {
+		positions[i] = make([]int, 4)
+	}
+
+	source := rand.NewSource(3)
+	for trial := 0; trial < 4000; trial += 1 {
+		sq := NewShardedQueue(3)
+		sq.SetRandSource(source)
+		for i := 0; i < 4; i += 1 {
+			sq.AddPriority(i, 1)
+		}
+
+		for position := 0; position < 4; position += 1 {
+			item, _ := sq.Pop()
+			positions[item.(int)][position] += 1
+		}
+	}
+
+	for _, counts := range positions {
+		_, pValue := fairness.ChiSquare(counts)
+		c.Assert(pValue >= fairness.DefaultAlpha/4, Equals, true)
+	}
+}
+
+// Test the approximate mode takes from the better of two shards.
+func (s *MySuite) TestShardedQueueApproximate(c *C) {
+	sq := NewShardedQueue(8)
+	sq.SetApproximate(true)
+	sq.SetRandSource(rand.NewSource(1))
+
+	for i := 0; i < 100; i += 1 {
+		sq.AddPriority(i, i%10)
+	}
+
+	// Every item still comes out, and never from below the lower of the two shards compared
+	for i := 0; i < 100; i += 1 {
+		_, ok := sq.Pop()
+		c.Assert(ok, Equals, true)
+	}
+	_, ok := sq.Pop()
+	c.Assert(ok, Equals, false)
+
+	// A single populated shard is found even when both random shards are empty
+	sq.AddPriority("hello", 1)
+	item, ok := sq.Shift()
+	c.Assert(ok, Equals, true)
+	c.Assert(item, Equals, "hello")
+}
+
+// Test SetRandSource seeds the tie breakers of the shards so that the order of a single shard is reproducible.
+func (s *MySuite) TestShardedQueueRandSource(c *C) {
+	pops := func() []interface{} {
+		sq := NewShardedQueue(1)
+		sq.SetRandSource(rand.NewSource(1))
+		for i := 0; i < 20; i += 1 {
+			sq.AddPriority(i, i%2)
+		}
+
+		items := []interface{}{}
+		for sq.Len() > 0 {
+			item, _ := sq.Pop()
+			items = append(items, item)
+		}
+
+		return items
+	}
+
+	c.Assert(pops(), DeepEquals, pops())
+}
+
+// Test choosing a shard with every shard locked takes from the overall highest or lowest priority.
+func (s *MySuite) TestShardedQueueTakeLocked(c *C) {
+	sq := NewShardedQueue(4)
+	for i := 0; i < 10; i += 1 {
+		sq.AddPriority(i, i)
+	}
+
+	item, ok := sq.takeLocked(true, (*ShuffledPriorityQueue).Pop)
+	c.Assert(ok, Equals, true)
+	c.Assert(item, Equals, 9)
+	item, ok = sq.takeLocked(false, (*ShuffledPriorityQueue).Shift)
+	c.Assert(ok, Equals, true)
+	c.Assert(item, Equals, 0)
+	c.Assert(sq.Len(), Equals, 8)
+
+	for sq.Len() > 0 {
+		sq.takeLocked(true, (*ShuffledPriorityQueue).Pop)
+	}
+	_, ok = sq.takeLocked(true, (*ShuffledPriorityQueue).Pop)
+	c.Assert(ok, Equals, false)
+}
+
+// Test a sharded queue may be used from many goroutines.
+func (s *MySuite) TestShardedQueueConcurrent(c *C) {
+	for _, approximate := range []bool{false, true} {
+		sq := NewShardedQueue(4)
+		sq.SetApproximate(approximate)
+
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g += 1 {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 100; i += 1 {
+					sq.AddPriority(g*100+i, i%5)
+					if i%2 == 0 {
+						sq.Pop()
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		c.Assert(sq.Len(), Equals, 400)
+		for i := range sq.shards {
+			c.Assert(sq.shards[i].spq.Validate(), IsNil)
+		}
+	}
+}
+
+// Adds and pops from as many goroutines as GOMAXPROCS.
+func benchmarkConcurrent(c *C, q Queue) {
+	procs := runtime.GOMAXPROCS(0)
+	per := c.N/procs + 1
+
+	c.ResetTimer()
+
+	var wg sync.WaitGroup
+	for g := 0; g < procs; g += 1 {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < per; i += 1 {
+				q.AddPriority(g*per+i, i%16)
+				q.Pop()
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func (s *MySuite) BenchmarkSyncQueueConcurrent(c *C) {
+	benchmarkConcurrent(c, NewSyncQueue(NewSPQ()))
+}
+
+func (s *MySuite) BenchmarkShardedQueueConcurrent(c *C) {
+	benchmarkConcurrent(c, NewShardedQueue(runtime.GOMAXPROCS(0)))
+}
+
+func (s *MySuite) BenchmarkShardedQueueApproximateConcurrent(c *C) {
+	sq := NewShardedQueue(runtime.GOMAXPROCS(0))
+	sq.SetApproximate(true)
+
+	benchmarkConcurrent(c, sq)
+}
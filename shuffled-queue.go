@@ -27,31 +27,69 @@ package go_shuffled_queue
 
 import (
 	"sort"
-	"math/rand"
-	"time"
-
-	"deckarep/golang-set"
 )
 
 // The default priority of all items unless specified otherwise
 const DefaultPriority = 0
 
 type ShuffledPriorityQueue struct {
-	priorities map[int]mapset.Set
-	keys       []int
-	length     uint
+	priorities  map[int]*bucket
+	keys        []int
+	length      uint
+	tieBreaker  TieBreaker
+	tieBreakers map[int]TieBreaker
+	capacity    uint
+	closed      bool
+	multiset    bool
+	clock       Clock
+	sampler     *random
+	pipe        *pipe
+	limits      []*tokenBucket
 }
 
 // Creates and returns a reference to an empty shuffled priority queue.
+// Items with the same priority are picked uniformly at random.
 func NewSPQ() *ShuffledPriorityQueue {
 	spq := ShuffledPriorityQueue{
-		priorities: make(map[int]mapset.Set),
-		keys:       []int{},
-		length:     uint(0)}
+		priorities:  make(map[int]*bucket),
+		keys:        []int{},
+		length:      uint(0),
+		tieBreaker:  NewRandomTieBreaker(nil),
+		tieBreakers: make(map[int]TieBreaker),
+		clock:       systemClock{},
+		sampler:     newRand(nil),
+		pipe:        newPipe()}
 
 	return &spq
 }
 
+// Creates and returns a reference to an empty shuffled priority queue in multiset mode.
+// Adding an item that already exists with the same priority adds one more occurrence of it,
+// removing or popping it removes a single occurrence. Items occurring more than once
+// are proportionally more likely to be picked among items with the same priority.
+func NewMultisetSPQ() *ShuffledPriorityQueue {
+	spq := NewSPQ()
+	spq.multiset = true
+
+	return spq
+}
+
+// Sets the tie breaker used by every priority bucket that has no tie breaker of its own.
+func (spq *ShuffledPriorityQueue) SetTieBreaker(tb TieBreaker) {
+	spq.tieBreaker = tb
+}
+
+// Sets the tie breaker used only by the items of the specified priority.
+// Passing nil restores the queue tie breaker for that priority.
+func (spq *ShuffledPriorityQueue) SetPriorityTieBreaker(priority int, tb TieBreaker) {
+	if tb == nil {
+		delete(spq.tieBreakers, priority)
+		return
+	}
+
+	spq.tieBreakers[priority] = tb
+}
+
 // Adds an item to the priority queue using the default priority.
 // Returns the value added.
 func (spq *ShuffledPriorityQueue) Add(v interface{}) interface{} {
@@ -59,67 +97,136 @@ func (spq *ShuffledPriorityQueue) Add(v interface{}) interface{} {
 }
 
 // Adds an item to the priority queue using a specified priority.
-// Returns the value added.
+// Returns the value added. Items that cannot be added are dropped, see TryAddPriority.
 func (spq *ShuffledPriorityQueue) AddPriority(v interface{}, priority int) interface{} {
-	_, ok := spq.priorities[priority]
-
-	if !ok {
-		spq.priorities[priority] = mapset.NewSet()
-		spq.keys = append(spq.keys, priority)
+	spq.TryAddPriority(v, priority)
+	return v
+}
 
-		// We maintain a sorted list of keys for Pop, Shift operations
-		sort.Ints(spq.keys)
-	}
+// Adds an item to the priority queue using the default priority.
+// Returns an error if the item could not be added.
+func (spq *ShuffledPriorityQueue) TryAdd(v interface{}) error {
+	return spq.TryAddPriority(v, DefaultPriority)
+}
 
-	if spq.priorities[priority].Add(v) {
-		spq.length += 1
-	}
+// Adds an item to the priority queue using a specified priority. Adding an item that already
+// exists with the same priority does nothing. Returns ErrClosed if the queue is closed,
+// ErrUnhashable if the item cannot be stored or ErrFull if the queue is at capacity.
+func (spq *ShuffledPriorityQueue) TryAddPriority(v interface{}, priority int) error {
+	defer spq.checkInvariants("AddPriority")
 
-	return v
+	return spq.put(v, v, priority)
 }
 
-// Remove the item from the queue if exists.
+// Remove the item from the queue if exists. Passing a handle returned by Push removes its item.
 // Returns true if item was removed or false if the item was not found.
 func (spq *ShuffledPriorityQueue) Remove(v interface{}) bool {
-	priority, found := spq.FindPriority(v)
+	return spq.TryRemove(v) == nil
+}
 
-	if !found {
-		return false
+// Removes the lowest priority occurrence of the item from the queue.
+// Passing a handle returned by Push removes its item.
+// Returns ErrNotFound if the item is not in the queue or ErrUnhashable if it cannot be stored.
+func (spq *ShuffledPriorityQueue) TryRemove(v interface{}) error {
+	defer spq.checkInvariants("Remove")
+
+	if h, ok := v.(*Handle); ok {
+		return spq.removeHandle(h)
 	}
 
-	spq.priorities[priority].Remove(v)
+	priority, err := spq.TryFindPriority(v)
 
-	// Cleanup the priority queue so that it does not grow too big
-	if spq.priorities[priority].Cardinality() == 0 {
-		spq.removePriorityKey(priority)
+	if err != nil {
+		return err
 	}
 
-	return true
+	spq.remove(v, priority)
+	return nil
 }
 
 // Attempts to find the first specified item and returns its priority.
 // Returns true if found otherwise false.
 func (spq *ShuffledPriorityQueue) FindPriority(v interface{}) (int, bool) {
-	if spq.length == 0 {
+	priority, err := spq.TryFindPriority(v)
+
+	if err != nil {
 		return -1, false
 	}
 
+	return priority, true
+}
+
+// Returns the lowest priority of the item.
+// Returns ErrNotFound if the item is not in the queue or ErrUnhashable if it cannot be stored.
+func (spq *ShuffledPriorityQueue) TryFindPriority(v interface{}) (int, error) {
+	if !hashable(v) {
+		return 0, ErrUnhashable
+	}
+
 	for i := 0; i < len(spq.keys); i += 1 {
-		priority := spq.keys[i];
+		priority := spq.keys[i]
 		if spq.priorities[priority].Contains(v) {
 			// First found first served
-			return priority, true
+			return priority, nil
 		}
 	}
 
-	return -1, false
+	return 0, ErrNotFound
+}
+
+// Returns how many times the item occurs in the queue across all priorities.
+// Outside of multiset mode an item occurs at most once per priority.
+func (spq *ShuffledPriorityQueue) Count(v interface{}) int {
+	if !hashable(v) {
+		return 0
+	}
+
+	count := 0
+	for _, b := range spq.priorities {
+		count += b.count(v)
+	}
+
+	return count
+}
+
+// Returns the number of items in the queue.
+func (spq *ShuffledPriorityQueue) Len() int {
+	return int(spq.length)
 }
 
 // Returns the first item from the queue if its the only one.
 // Returns true if found otherwise false.
 func (spq *ShuffledPriorityQueue) First() (interface{}, bool) {
-	if spq.length == 0 {
-		return nil, false
+	item, err := spq.TryFirst()
+	return item, err == nil
+}
+
+// Returns the last item from the queue if its the only one.
+// Returns true if found otherwise false. Does not mutate the queue.
+func (spq *ShuffledPriorityQueue) Last() (interface{}, bool) {
+	item, err := spq.TryLast()
+	return item, err == nil
+}
+
+// Removes and returns the highest priority item from the queue if its the only one.
+// Returns true if found otherwise false.
+func (spq *ShuffledPriorityQueue) Pop() (interface{}, bool) {
+	item, err := spq.TryPop()
+	return item, err == nil
+}
+
+// Removes and returns the lowest priority item from the queue if its the only one.
+// Returns true if found otherwise false.
+func (spq *ShuffledPriorityQueue) Shift() (interface{}, bool) {
+	item, err := spq.TryShift()
+	return item, err == nil
+}
+
+// Returns the lowest priority item from the queue without mutating it.
+// Returns ErrEmpty if the queue is empty or ErrClosed if it is also closed.
+func (spq *ShuffledPriorityQueue) TryFirst() (interface{}, error) {
+	if err := spq.checkNotEmpty(); err != nil {
+		return nil, err
 	}
 
 	// We assume keys are sorted otherwise we sort them now
@@ -129,15 +236,15 @@ func (spq *ShuffledPriorityQueue) First() (interface{}, bool) {
 
 	lowestPriorityKey := spq.keys[0]
 
-	item := spq.pickRandom(spq.priorities[lowestPriorityKey])
-	return item, true
+	item := spq.pick(lowestPriorityKey)
+	return spq.priorities[lowestPriorityKey].value(item), nil
 }
 
-// Returns the last item from the queue if its the only one.
-// Returns true if found otherwise false. Does not mutate the queue.
-func (spq *ShuffledPriorityQueue) Last() (interface{}, bool) {
-	if spq.length == 0 {
-		return nil, false
+// Returns the highest priority item from the queue without mutating it.
+// Returns ErrEmpty if the queue is empty or ErrClosed if it is also closed.
+func (spq *ShuffledPriorityQueue) TryLast() (interface{}, error) {
+	if err := spq.checkNotEmpty(); err != nil {
+		return nil, err
 	}
 
 	// We assume keys are sorted otherwise we sort them now
@@ -147,45 +254,219 @@ func (spq *ShuffledPriorityQueue) Last() (interface{}, bool) {
 
 	highestPriorityKey := spq.keys[len(spq.keys)-1]
 
-	item := spq.pickRandom(spq.priorities[highestPriorityKey])
-	return item, true
+	item := spq.pick(highestPriorityKey)
+	return spq.priorities[highestPriorityKey].value(item), nil
 }
 
-// Removes and returns the highest priority item from the queue if its the only one.
-// Returns true if found otherwise false.
-func (spq *ShuffledPriorityQueue) Pop() (interface{}, bool) {
-	if spq.length == 0 {
-		return nil, false
+// Removes and returns the highest priority item from the queue, skipping the priorities that are rate limited.
+// Returns ErrEmpty if the queue is empty, ErrClosed if it is also closed or ErrRateLimited if every priority
+// holding items is rate limited.
+func (spq *ShuffledPriorityQueue) TryPop() (interface{}, error) {
+	defer spq.checkInvariants("Pop")
+
+	if err := spq.checkNotEmpty(); err != nil {
+		return nil, err
+	}
+
+	priority, ok := spq.allowedKey(0, len(spq.keys), true)
+	if !ok {
+		return nil, ErrRateLimited
 	}
 
-	item, _ := spq.Last()
-	return item, spq.Remove(item)
+	_, payload := spq.take(priority)
+	return payload, nil
 }
 
-// Removes and returns the lowest priority item from the queue if its the only one.
-// Returns true if found otherwise false.
-func (spq *ShuffledPriorityQueue) Shift() (interface{}, bool) {
-	if spq.length == 0 {
-		return nil, false
+// Removes and returns the lowest priority item from the queue, skipping the priorities that are rate limited.
+// Returns ErrEmpty if the queue is empty, ErrClosed if it is also closed or ErrRateLimited if every priority
+// holding items is rate limited.
+func (spq *ShuffledPriorityQueue) TryShift() (interface{}, error) {
+	defer spq.checkInvariants("Shift")
+
+	if err := spq.checkNotEmpty(); err != nil {
+		return nil, err
 	}
 
-	item, _ := spq.First()
-	return item, spq.Remove(item)
+	priority, ok := spq.allowedKey(0, len(spq.keys), false)
+	if !ok {
+		return nil, ErrRateLimited
+	}
+
+	_, payload := spq.take(priority)
+	return payload, nil
+}
+
+// Sets the maximum number of items the queue holds, adding more fails with ErrFull.
+// A capacity of 0 means the queue is unbounded. Items already in the queue are kept.
+func (spq *ShuffledPriorityQueue) SetCapacity(capacity uint) {
+	spq.capacity = capacity
+}
+
+// Closes the queue. Adding to a closed queue fails with ErrClosed,
+// items already in the queue can still be taken out until it is empty.
+// Close may be called while Feed or Stream run, streams end once the queue is empty.
+func (spq *ShuffledPriorityQueue) Close() {
+	spq.pipe.mu.Lock()
+	defer spq.pipe.mu.Unlock()
+
+	spq.closed = true
+	spq.pipe.broadcast(&spq.pipe.added)
+}
+
+// Returns true if the queue is closed.
+func (spq *ShuffledPriorityQueue) Closed() bool {
+	return spq.closed
 }
 
-// Picks a random element from the set
-func (spq *ShuffledPriorityQueue) pickRandom(S mapset.Set) interface{} {
-	rand.Seed(time.Now().UTC().UnixNano())
-	randomIndex := rand.Intn(S.Cardinality())
+// Returns ErrEmpty or ErrClosed if there is no item to take out of the queue.
+func (spq *ShuffledPriorityQueue) checkNotEmpty() error {
+	if spq.length > 0 {
+		return nil
+	}
+
+	if spq.closed {
+		return ErrClosed
+	}
+
+	return ErrEmpty
+}
+
+// Picks an item from the bucket of the specified priority using its tie breaker.
+func (spq *ShuffledPriorityQueue) pick(priority int) interface{} {
+	b := spq.priorities[priority]
+	return b.at(spq.tieBreakerOf(priority).Pick(priority, b.size, b.valueAt))
+}
+
+// Returns the tie breaker picking the items of the specified priority.
+func (spq *ShuffledPriorityQueue) tieBreakerOf(priority int) TieBreaker {
+	if tb, ok := spq.tieBreakers[priority]; ok {
+		return tb
+	}
 
-	return S.ToSlice()[randomIndex]
+	return spq.tieBreaker
+}
+
+// Tells the tie breaker of the priority, if it watches buckets, that the bucket of the priority is gone.
+func (spq *ShuffledPriorityQueue) dropped(priority int) {
+	if w, ok := spq.tieBreakerOf(priority).(bucketWatcher); ok {
+		w.Dropped(priority)
+	}
+}
+
+// Tells the tie breaker of the priority, if it watches buckets, that an occurrence of the item was just added.
+// The new occurrence is the last one of the item.
+func (spq *ShuffledPriorityQueue) inserted(v interface{}, priority int) {
+	if w, ok := spq.tieBreakerOf(priority).(bucketWatcher); ok {
+		b := spq.priorities[priority]
+		w.Inserted(priority, b.rank(v)+b.count(v)-1)
+	}
+}
+
+// Adds an item with its payload to the bucket of the specified priority.
+// Returns ErrClosed, ErrUnhashable or ErrFull if the item cannot be added.
+func (spq *ShuffledPriorityQueue) put(v interface{}, payload interface{}, priority int) error {
+	if spq.closed {
+		return ErrClosed
+	}
+
+	if !hashable(v) {
+		return ErrUnhashable
+	}
+
+	_, keyed := v.(keyRef)
+	_, handle := v.(*Handle)
+	keyed = keyed || handle
+	exists := spq.contains(v, priority)
+
+	// Adding a keyed item again replaces its payload
+	if exists && keyed {
+		spq.writableBucket(priority).put(v, payload)
+		return nil
+	}
+
+	if exists && !spq.multiset {
+		return nil
+	}
+
+	if spq.capacity > 0 && spq.length >= spq.capacity {
+		return ErrFull
+	}
+
+	if exists {
+		spq.writableBucket(priority).increment(v)
+		spq.length += 1
+		spq.inserted(v, priority)
+
+		return nil
+	}
+
+	spq.insert(v, payload, priority)
+	return nil
+}
+
+// Adds an item that is not in the bucket of the specified priority, creating the bucket if needed.
+func (spq *ShuffledPriorityQueue) insert(v interface{}, payload interface{}, priority int) {
+	_, ok := spq.priorities[priority]
+
+	if !ok {
+		spq.priorities[priority] = newBucket()
+		spq.keys = append(spq.keys, priority)
+
+		// We maintain a sorted list of keys for Pop, Shift operations
+		sort.Ints(spq.keys)
+	}
+
+	b := spq.writableBucket(priority)
+	b.put(v, payload)
+	b.meta[v] = metadata{enqueued: spq.clock.Now()}
+
+	spq.length += 1
+	spq.inserted(v, priority)
+}
+
+// Removes an item picked by the tie breaker from the bucket of the specified priority.
+// Returns the key and the payload of the item.
+func (spq *ShuffledPriorityQueue) take(priority int) (interface{}, interface{}) {
+	item := spq.pick(priority)
+	key, payload := spq.priorities[priority].entry(item)
+
+	spq.remove(item, priority)
+	return key, payload
+}
+
+// Removes the item from the bucket of the specified priority.
+// In multiset mode only one occurrence of the item is removed, the last one.
+func (spq *ShuffledPriorityQueue) remove(v interface{}, priority int) {
+	w, watching := spq.tieBreakerOf(priority).(bucketWatcher)
+	i := 0
+
+	if watching {
+		b := spq.priorities[priority]
+		i = b.rank(v) + b.count(v) - 1
+	}
+
+	spq.writableBucket(priority).decrement(v)
+	spq.length -= 1
+
+	if h, ok := v.(*Handle); ok && h.queue == spq {
+		h.queue = nil
+	}
+
+	if watching {
+		w.Removed(priority, i)
+	}
+
+	// Cleanup the priority queue so that it does not grow too big
+	if spq.priorities[priority].Cardinality() == 0 {
+		spq.removePriorityKey(priority)
+	}
 }
 
 func (spq *ShuffledPriorityQueue) removePriorityKey(priority int) {
 	delete(spq.priorities, priority)
+	spq.dropped(priority)
 	sort.Ints(spq.keys)
 	i := sort.SearchInts(spq.keys, priority)
 
 	spq.keys = append(spq.keys[:i], spq.keys[i+1:]...)
-	spq.length -= 1
 }
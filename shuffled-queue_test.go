@@ -2,6 +2,8 @@ package go_shuffled_queue
 
 import (
 	"testing"
+
+	. "gopkg.in/check.v1"
 )
 
 // Hook up gocheck into the "go test" runner.
@@ -113,6 +115,23 @@ func (s *MySuite) TestRemoveWhenRemovesEmptyPriorityKeyBuckets(c *C) {
 	c.Assert(spq.length, Equals, uint(0))
 }
 
+// Test Removing an Item that leaves its priority bucket non empty still counts it out of the queue.
+func (s *MySuite) TestRemoveWhenBucketNotEmptyDecrementsLength(c *C) {
+	spq := NewSPQ()
+
+	spq.AddPriority("hello", 1)
+	spq.AddPriority("world", 1)
+	spq.Remove("hello")
+
+	c.Assert(spq.length, Equals, uint(1))
+
+	spq.Pop()
+	c.Assert(spq.length, Equals, uint(0))
+
+	_, ok := spq.Pop()
+	c.Assert(ok, Equals, false)
+}
+
 // Test First on empty queue
 func (s *MySuite) TestFirstOnEmptyQueue(c *C) {
 	spq := NewSPQ()
@@ -0,0 +1,55 @@
+package go_shuffled_queue
+
+// Returns a deep copy of the queue. The copy uses copies of the tie breakers of the queue, so it makes
+// the same picks as the queue would until either of them is mutated. It has the rate limits of the queue
+// with copies of the tokens left, spending them independently, as well as its capacity and closed state.
+func (spq *ShuffledPriorityQueue) Clone() *ShuffledPriorityQueue {
+	clone := spq.emptyCopy()
+	clone.limits = spq.copyLimits()
+	clone.capacity, clone.closed = spq.capacity, spq.closed
+
+	for _, priority := range spq.keys {
+		clone.setBucket(priority, spq.priorities[priority].clone())
+	}
+
+	return clone
+}
+
+// Returns a copy-on-write snapshot of the queue in O(number of priorities).
+// The snapshot shares the items storage with the queue until either side mutates a priority,
+// at which point only that priority is copied. Mutations of either side never show in the other.
+// The snapshot uses copies of the tie breakers and the rate limits of the queue, so picking from either side
+// never changes the picks or the tokens left of the other. The snapshot has the capacity and the closed state
+// of the queue.
+func (spq *ShuffledPriorityQueue) Snapshot() *ShuffledPriorityQueue {
+	defer spq.checkInvariants("Snapshot")
+
+	snapshot := spq.emptyCopy()
+	snapshot.limits = spq.copyLimits()
+	snapshot.capacity, snapshot.closed = spq.capacity, spq.closed
+	snapshot.keys = append(snapshot.keys, spq.keys...)
+	snapshot.length = spq.length
+
+	for priority, b := range spq.priorities {
+		b.share()
+		snapshot.priorities[priority] = b
+	}
+
+	return snapshot
+}
+
+// Returns the bucket of the specified priority ready to be mutated,
+// copying it first if it is shared with a snapshot.
+func (spq *ShuffledPriorityQueue) writableBucket(priority int) *bucket {
+	b := spq.priorities[priority]
+
+	if b.shared() {
+		nb := b.clone()
+		b.release()
+		spq.priorities[priority] = nb
+
+		return nb
+	}
+
+	return b
+}
@@ -0,0 +1,142 @@
+package go_shuffled_queue
+
+import (
+	"math/rand"
+
+	. "gopkg.in/check.v1"
+)
+
+// Test Clone returns an independent deep copy.
+func (s *MySuite) TestClone(c *C) {
+	spq := newSPQWith(map[string]int{"hello": 1, "world": 1, "welt": 2})
+	clone := spq.Clone()
+
+	c.Assert(clone.length, Equals, uint(3))
+	c.Assert(clone.keys, DeepEquals, []int{1, 2})
+	c.Assert(clone.priorities[1] == spq.priorities[1], Equals, false)
+
+	clone.Remove("hello")
+	spq.AddPriority("verden", 2)
+
+	c.Assert(spq.PeekBucket(1), HasLen, 2)
+	c.Assert(clone.PeekBucket(2), DeepEquals, []interface{}{"welt"})
+}
+
+// Test clones and snapshots keep the capacity and the closed state of the queue.
+func (s *MySuite) TestCopiesCapacityAndClosed(c *C) {
+	spq := NewSPQ()
+	spq.SetCapacity(1)
+	spq.Add("hello")
+
+	for _, q := range []*ShuffledPriorityQueue{spq.Clone(), spq.Snapshot()} {
+		c.Assert(q.TryAdd("world"), Equals, ErrFull)
+		c.Assert(q.Closed(), Equals, false)
+	}
+
+	spq.Close()
+
+	for _, q := range []*ShuffledPriorityQueue{spq.Clone(), spq.Snapshot()} {
+		c.Assert(q.Closed(), Equals, true)
+		c.Assert(q.TryAdd("world"), Equals, ErrClosed)
+
+		_, err := q.TryPop()
+		c.Assert(err, IsNil)
+		_, err = q.TryPop()
+		c.Assert(err, Equals, ErrClosed)
+	}
+}
+
+// Test Snapshot shares buckets until either side mutates them.
+func (s *MySuite) TestSnapshotSharesBuckets(c *C) {
+	spq := newSPQWith(map[string]int{"hello": 1, "world": 2})
+	snapshot := spq.Snapshot()
+
+	c.Assert(snapshot.priorities[1] == spq.priorities[1], Equals, true)
+	c.Assert(snapshot.priorities[2] == spq.priorities[2], Equals, true)
+
+	spq.AddPriority("welt", 1)
+
+	c.Assert(snapshot.priorities[1] == spq.priorities[1], Equals, false)
+	c.Assert(snapshot.priorities[2] == spq.priorities[2], Equals, true)
+}
+
+// Test mutations of the queue do not leak into the snapshot.
+func (s *MySuite) TestSnapshotIsolatedFromQueue(c *C) {
+	spq := newSPQWith(map[string]int{"hello": 1, "world": 2})
+	snapshot := spq.Snapshot()
+
+	spq.AddPriority("welt", 1)
+	spq.AddPriority("verden", 3)
+	spq.Remove("world")
+	spq.Pop()
+
+	c.Assert(snapshot.length, Equals, uint(2))
+	c.Assert(snapshot.keys, DeepEquals, []int{1, 2})
+	c.Assert(snapshot.PeekBucket(1), DeepEquals, []interface{}{"hello"})
+	c.Assert(snapshot.PeekBucket(2), DeepEquals, []interface{}{"world"})
+}
+
+// Test mutations of the snapshot do not leak into the queue.
+func (s *MySuite) TestSnapshotIsolatedFromSnapshot(c *C) {
+	spq := newSPQWith(map[string]int{"hello": 1, "world": 2})
+	snapshot := spq.Snapshot()
+
+	snapshot.AddPriority("welt", 1)
+	snapshot.RemovePriority(2)
+	snapshot.Shift()
+
+	c.Assert(spq.length, Equals, uint(2))
+	c.Assert(spq.keys, DeepEquals, []int{1, 2})
+	c.Assert(spq.PeekBucket(1), DeepEquals, []interface{}{"hello"})
+	c.Assert(spq.PeekBucket(2), DeepEquals, []interface{}{"world"})
+}
+
+// Test a bucket released by one side is mutated in place by the other.
+func (s *MySuite) TestSnapshotReleasesBuckets(c *C) {
+	spq := newSPQWith(map[string]int{"hello": 1})
+	snapshot := spq.Snapshot()
+
+	spq.AddPriority("world", 1)
+	b := snapshot.priorities[1]
+	snapshot.AddPriority("welt", 1)
+
+	c.Assert(snapshot.priorities[1] == b, Equals, true)
+	c.Assert(spq.PeekBucket(1), DeepEquals, []interface{}{"hello", "world"})
+	c.Assert(snapshot.PeekBucket(1), DeepEquals, []interface{}{"hello", "welt"})
+}
+
+// Test popping from a snapshot and from the queue at the same time leaves the order of either unchanged.
+func (s *MySuite) TestSnapshotTieBreakerState(c *C) {
+	for _, tb := range []TieBreaker{
+		NewRandomTieBreaker(rand.NewSource(1)),
+		NewRoundRobinTieBreaker(),
+		NewShuffleTieBreaker(rand.NewSource(1))} {
+		spq := NewSPQ()
+		spq.SetTieBreaker(tb)
+		for i := 0; i < 50; i += 1 {
+			spq.AddPriority(i, i%3)
+		}
+
+		// A clone makes the same picks as the queue would on its own
+		expected := popAll(spq.Clone())
+		snapshot := spq.Snapshot()
+
+		done := make(chan []interface{})
+		go func() {
+			done <- popAll(snapshot)
+		}()
+
+		c.Assert(popAll(spq), DeepEquals, expected)
+		c.Assert(<-done, DeepEquals, expected)
+	}
+}
+
+func popAll(spq *ShuffledPriorityQueue) []interface{} {
+	items := []interface{}{}
+	for spq.Len() > 0 {
+		item, _ := spq.Pop()
+		items = append(items, item)
+	}
+
+	return items
+}
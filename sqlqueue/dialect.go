@@ -0,0 +1,38 @@
+package sqlqueue
+
+import (
+	"fmt"
+)
+
+// A Dialect adapts the queries of the queue to a database.
+type Dialect struct {
+	name string
+	// Returns the placeholder of the i-th parameter of a query, starting at 1.
+	placeholder func(i int) string
+	// The column identifying a row.
+	rowID string
+	// Appended to the queries selecting the row to delete so that concurrent pops pick different rows.
+	lock string
+}
+
+// The dialect of SQLite 3.35 or later. SQLite runs every statement atomically without row locks.
+var SQLite = Dialect{
+	name: "sqlite",
+	placeholder: func(i int) string {
+		return "?"
+	},
+	rowID: "rowid"}
+
+// The dialect of PostgreSQL 9.5 or later. Pops lock the row they pick and skip the rows locked by other pops.
+var Postgres = Dialect{
+	name: "postgres",
+	placeholder: func(i int) string {
+		return fmt.Sprintf("$%d", i)
+	},
+	rowID: "ctid",
+	lock:  " FOR UPDATE SKIP LOCKED"}
+
+// Returns the name of the dialect.
+func (d Dialect) String() string {
+	return d.name
+}
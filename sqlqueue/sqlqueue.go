@@ -0,0 +1,269 @@
+// Package sqlqueue implements a shuffled priority queue stored in a table of a relational database
+// through database/sql. Any driver may be used along with the dialect of its database.
+//
+// Values are stored as JSON and returned the way encoding/json decodes them into an interface{},
+// so numbers come back as float64. The queue creates its table if needed:
+//
+//	CREATE TABLE IF NOT EXISTS <table> (
+//		value    TEXT   NOT NULL,
+//		priority BIGINT NOT NULL,
+//		PRIMARY KEY (value, priority)
+//	);
+//	CREATE INDEX IF NOT EXISTS <table>_priority ON <table> (priority);
+//
+// A pop deletes in a single statement the row picked by ORDER BY priority DESC, random(),
+// so that values with the same priority are picked uniformly at random by the database.
+package sqlqueue
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	spq "github.com/theodesp/go-shuffled-queue"
+)
+
+// Returned by Open for table names that are not plain identifiers.
+var ErrTableName = errors.New("sqlqueue: table names must be identifiers made of letters, digits and underscores")
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// A Queue is a shuffled priority queue stored in a database table. It may be used from many goroutines
+// and processes sharing the database.
+type Queue struct {
+	db      *sql.DB
+	queries queries
+}
+
+var _ spq.Queue = (*Queue)(nil)
+
+// The queries of a queue, built once for its table and dialect.
+type queries struct {
+	add, remove, findPriority, pop, shift, first, last, length string
+}
+
+// Returns a queue stored in the table of the database, creating the table if needed.
+func Open(db *sql.DB, dialect Dialect, table string) (*Queue, error) {
+	if !identifier.MatchString(table) {
+		return nil, ErrTableName
+	}
+
+	schema := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	value    TEXT   NOT NULL,
+	priority BIGINT NOT NULL,
+	PRIMARY KEY (value, priority)
+)`, table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_priority ON %s (priority)", table, table)}
+
+	for _, statement := range schema {
+		if _, err := db.Exec(statement); err != nil {
+			return nil, err
+		}
+	}
+
+	q := Queue{db: db, queries: newQueries(dialect, table)}
+
+	return &q, nil
+}
+
+func newQueries(d Dialect, table string) queries {
+	p1, p2 := d.placeholder(1), d.placeholder(2)
+
+	take := func(order string) string {
+		return fmt.Sprintf("DELETE FROM %[1]s WHERE %[2]s = (SELECT %[2]s FROM %[1]s ORDER BY priority %[3]s, random() LIMIT 1%[4]s) RETURNING value",
+			table, d.rowID, order, d.lock)
+	}
+
+	peek := func(order string) string {
+		return fmt.Sprintf("SELECT value FROM %s ORDER BY priority %s, random() LIMIT 1", table, order)
+	}
+
+	return queries{
+		add: fmt.Sprintf("INSERT INTO %s (value, priority) VALUES (%s, %s) ON CONFLICT DO NOTHING", table, p1, p2),
+		remove: fmt.Sprintf("DELETE FROM %[1]s WHERE %[2]s = (SELECT %[2]s FROM %[1]s WHERE value = %[3]s ORDER BY priority LIMIT 1%[4]s)",
+			table, d.rowID, p1, d.lock),
+		findPriority: fmt.Sprintf("SELECT MIN(priority) FROM %s WHERE value = %s", table, p1),
+		pop:          take("DESC"),
+		shift:        take("ASC"),
+		first:        peek("ASC"),
+		last:         peek("DESC"),
+		length:       fmt.Sprintf("SELECT COUNT(*) FROM %s", table)}
+}
+
+// Adds a value to the queue using the default priority.
+// Returns the value added.
+func (q *Queue) Add(v interface{}) interface{} {
+	return q.AddPriority(v, spq.DefaultPriority)
+}
+
+// Adds a value to the queue using a specified priority.
+// Returns the value added. Values that cannot be added are dropped, see TryAddPriority.
+func (q *Queue) AddPriority(v interface{}, priority int) interface{} {
+	q.TryAddPriority(v, priority)
+	return v
+}
+
+// Removes the value from the queue if exists.
+// Returns true if the value was removed or false if the value was not found.
+func (q *Queue) Remove(v interface{}) bool {
+	return q.TryRemove(v) == nil
+}
+
+// Returns the lowest priority of the value.
+// Returns true if found otherwise false.
+func (q *Queue) FindPriority(v interface{}) (int, bool) {
+	priority, err := q.TryFindPriority(v)
+
+	if err != nil {
+		return -1, false
+	}
+
+	return priority, true
+}
+
+// Removes and returns the highest priority value from the queue.
+// Returns true if found otherwise false.
+func (q *Queue) Pop() (interface{}, bool) {
+	v, err := q.TryPop()
+	return v, err == nil
+}
+
+// Removes and returns the lowest priority value from the queue.
+// Returns true if found otherwise false.
+func (q *Queue) Shift() (interface{}, bool) {
+	v, err := q.TryShift()
+	return v, err == nil
+}
+
+// Returns the lowest priority value from the queue without removing it.
+// Returns true if found otherwise false.
+func (q *Queue) First() (interface{}, bool) {
+	v, err := q.TryFirst()
+	return v, err == nil
+}
+
+// Returns the highest priority value from the queue without removing it.
+// Returns true if found otherwise false.
+func (q *Queue) Last() (interface{}, bool) {
+	v, err := q.TryLast()
+	return v, err == nil
+}
+
+// Adds a value to the queue using a specified priority. Adding a value that already exists with the same
+// priority does nothing. Returns spq.ErrUnhashable if the value cannot be encoded as JSON or the error of
+// the database.
+func (q *Queue) TryAddPriority(v interface{}, priority int) error {
+	value, err := encodeValue(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.db.Exec(q.queries.add, value, priority)
+	return err
+}
+
+// Removes the lowest priority occurrence of the value from the queue.
+// Returns spq.ErrNotFound if the value is not in the queue.
+func (q *Queue) TryRemove(v interface{}) error {
+	value, err := encodeValue(v)
+	if err != nil {
+		return err
+	}
+
+	result, err := q.db.Exec(q.queries.remove, value)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return spq.ErrNotFound
+	}
+
+	return nil
+}
+
+// Returns the lowest priority of the value.
+// Returns spq.ErrNotFound if the value is not in the queue.
+func (q *Queue) TryFindPriority(v interface{}) (int, error) {
+	value, err := encodeValue(v)
+	if err != nil {
+		return 0, err
+	}
+
+	var priority sql.NullInt64
+	if err := q.db.QueryRow(q.queries.findPriority, value).Scan(&priority); err != nil {
+		return 0, err
+	}
+
+	if !priority.Valid {
+		return 0, spq.ErrNotFound
+	}
+
+	return int(priority.Int64), nil
+}
+
+// Removes and returns the highest priority value from the queue.
+// Returns spq.ErrEmpty if the queue is empty.
+func (q *Queue) TryPop() (interface{}, error) {
+	return q.queryValue(q.queries.pop)
+}
+
+// Removes and returns the lowest priority value from the queue.
+// Returns spq.ErrEmpty if the queue is empty.
+func (q *Queue) TryShift() (interface{}, error) {
+	return q.queryValue(q.queries.shift)
+}
+
+// Returns the lowest priority value from the queue without removing it.
+// Returns spq.ErrEmpty if the queue is empty.
+func (q *Queue) TryFirst() (interface{}, error) {
+	return q.queryValue(q.queries.first)
+}
+
+// Returns the highest priority value from the queue without removing it.
+// Returns spq.ErrEmpty if the queue is empty.
+func (q *Queue) TryLast() (interface{}, error) {
+	return q.queryValue(q.queries.last)
+}
+
+// Returns the number of values in the queue.
+func (q *Queue) Len() (int, error) {
+	var length int
+	err := q.db.QueryRow(q.queries.length).Scan(&length)
+	return length, err
+}
+
+// Runs a query returning at most one value.
+func (q *Queue) queryValue(query string) (interface{}, error) {
+	var value string
+
+	err := q.db.QueryRow(query).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, spq.ErrEmpty
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	err = json.Unmarshal([]byte(value), &v)
+	return v, err
+}
+
+func encodeValue(v interface{}) (string, error) {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return "", spq.ErrUnhashable
+	}
+
+	return string(value), nil
+}
@@ -0,0 +1,134 @@
+package sqlqueue
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	. "gopkg.in/check.v1"
+	_ "modernc.org/sqlite"
+
+	spq "github.com/theodesp/go-shuffled-queue"
+	"github.com/theodesp/go-shuffled-queue/queuetest"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type SQLSuite struct {
+	db *sql.DB
+}
+
+var _ = Suite(&SQLSuite{})
+
+func (s *SQLSuite) SetUpTest(c *C) {
+	db, err := sql.Open("sqlite", filepath.Join(c.MkDir(), "queue.db")+"?_pragma=busy_timeout(5000)")
+	c.Assert(err, IsNil)
+	s.db = db
+}
+
+func (s *SQLSuite) TearDownTest(c *C) {
+	s.db.Close()
+}
+
+func (s *SQLSuite) open(c *C, table string) *Queue {
+	q, err := Open(s.db, SQLite, table)
+	c.Assert(err, IsNil)
+
+	return q
+}
+
+// Test the queue conforms to the behaviour of the in process queue.
+func (s *SQLSuite) TestConformance(c *C) {
+	queues := 0
+
+	c.Assert(queuetest.Check(func() spq.Queue {
+		queues += 1
+		return s.open(c, fmt.Sprintf("queue_%d", queues))
+	}), IsNil)
+}
+
+// Test queues in different tables are independent and reopening a table keeps its values.
+func (s *SQLSuite) TestTables(c *C) {
+	jobs := s.open(c, "jobs")
+	jobs.AddPriority(map[string]interface{}{"id": 7}, 3)
+	jobs.AddPriority("hello", 1)
+
+	v, ok := s.open(c, "other").Pop()
+	c.Assert(v, IsNil)
+	c.Assert(ok, Equals, false)
+
+	jobs = s.open(c, "jobs")
+	length, err := jobs.Len()
+	c.Assert(err, IsNil)
+	c.Assert(length, Equals, 2)
+
+	v, _ = jobs.Pop()
+	c.Assert(v, DeepEquals, map[string]interface{}{"id": 7.0})
+}
+
+// Test concurrent pops hand every value out exactly once.
+func (s *SQLSuite) TestConcurrentPops(c *C) {
+	q := s.open(c, "jobs")
+	for i := 0; i < 200; i += 1 {
+		q.AddPriority(i, i%4)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	seen := map[float64]bool{}
+
+	for g := 0; g < 4; g += 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				v, err := q.TryPop()
+				if err == spq.ErrEmpty {
+					return
+				}
+				if err != nil {
+					continue
+				}
+
+				mu.Lock()
+				seen[v.(float64)] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	c.Assert(seen, HasLen, 200)
+}
+
+// Test the errors of the queue.
+func (s *SQLSuite) TestErrors(c *C) {
+	q := s.open(c, "jobs")
+
+	_, err := q.TryPop()
+	c.Assert(err, Equals, spq.ErrEmpty)
+	_, err = q.TryLast()
+	c.Assert(err, Equals, spq.ErrEmpty)
+	_, err = q.TryFindPriority("hello")
+	c.Assert(err, Equals, spq.ErrNotFound)
+	c.Assert(q.TryRemove("hello"), Equals, spq.ErrNotFound)
+	c.Assert(q.TryAddPriority(func() {}, 1), Equals, spq.ErrUnhashable)
+
+	_, err = Open(s.db, SQLite, "jobs; DROP TABLE jobs")
+	c.Assert(err, Equals, ErrTableName)
+}
+
+// Test the queries of the dialects.
+func (s *SQLSuite) TestDialects(c *C) {
+	c.Assert(SQLite.String(), Equals, "sqlite")
+	c.Assert(newQueries(SQLite, "jobs").add, Equals, "INSERT INTO jobs (value, priority) VALUES (?, ?) ON CONFLICT DO NOTHING")
+
+	pg := newQueries(Postgres, "jobs")
+	c.Assert(pg.add, Equals, "INSERT INTO jobs (value, priority) VALUES ($1, $2) ON CONFLICT DO NOTHING")
+	c.Assert(pg.pop, Equals, "DELETE FROM jobs WHERE ctid = (SELECT ctid FROM jobs ORDER BY priority DESC, random() LIMIT 1 FOR UPDATE SKIP LOCKED) RETURNING value")
+}
@@ -0,0 +1,105 @@
+package go_shuffled_queue
+
+import (
+	"sync"
+)
+
+// A SyncQueue makes a shuffled priority queue safe to use from many goroutines by holding a lock
+// around every call.
+type SyncQueue struct {
+	mu  sync.Mutex
+	spq *ShuffledPriorityQueue
+}
+
+var _ Queue = (*SyncQueue)(nil)
+
+// Creates and returns a reference to a queue locking around the specified queue,
+// which must not be used directly anymore.
+func NewSyncQueue(spq *ShuffledPriorityQueue) *SyncQueue {
+	return &SyncQueue{spq: spq}
+}
+
+// Runs f with the lock held, to use the methods of the queue that SyncQueue does not expose.
+func (sq *SyncQueue) Do(f func(spq *ShuffledPriorityQueue)) {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+
+	f(sq.spq)
+}
+
+// Adds an item to the priority queue using the default priority.
+// Returns the value added.
+func (sq *SyncQueue) Add(v interface{}) interface{} {
+	return sq.AddPriority(v, DefaultPriority)
+}
+
+// Adds an item to the priority queue using a specified priority.
+// Returns the value added.
+func (sq *SyncQueue) AddPriority(v interface{}, priority int) interface{} {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+
+	return sq.spq.AddPriority(v, priority)
+}
+
+// Remove the item from the queue if exists.
+// Returns true if item was removed or false if the item was not found.
+func (sq *SyncQueue) Remove(v interface{}) bool {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+
+	return sq.spq.Remove(v)
+}
+
+// Returns the lowest priority of the item.
+// Returns true if found otherwise false.
+func (sq *SyncQueue) FindPriority(v interface{}) (int, bool) {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+
+	return sq.spq.FindPriority(v)
+}
+
+// Removes and returns the highest priority item from the queue.
+// Returns true if found otherwise false.
+func (sq *SyncQueue) Pop() (interface{}, bool) {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+
+	return sq.spq.Pop()
+}
+
+// Removes and returns the lowest priority item from the queue.
+// Returns true if found otherwise false.
+func (sq *SyncQueue) Shift() (interface{}, bool) {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+
+	return sq.spq.Shift()
+}
+
+// Returns the lowest priority item from the queue without removing it.
+// Returns true if found otherwise false.
+func (sq *SyncQueue) First() (interface{}, bool) {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+
+	return sq.spq.First()
+}
+
+// Returns the highest priority item from the queue without removing it.
+// Returns true if found otherwise false.
+func (sq *SyncQueue) Last() (interface{}, bool) {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+
+	return sq.spq.Last()
+}
+
+// Returns the number of items in the queue.
+func (sq *SyncQueue) Len() int {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+
+	return sq.spq.Len()
+}
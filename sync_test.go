@@ -0,0 +1,33 @@
+package go_shuffled_queue
+
+import (
+	"sync"
+
+	. "gopkg.in/check.v1"
+)
+
+// Test a SyncQueue may be used from many goroutines.
+func (s *MySuite) TestSyncQueue(c *C) {
+	sq := NewSyncQueue(NewSPQ())
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g += 1 {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i += 1 {
+				sq.AddPriority(g*100+i, i%5)
+				if i%2 == 0 {
+					sq.Pop()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	c.Assert(sq.Len(), Equals, 400)
+
+	sq.Do(func(spq *ShuffledPriorityQueue) {
+		c.Assert(spq.Validate(), IsNil)
+	})
+}
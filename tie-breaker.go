@@ -0,0 +1,254 @@
+package go_shuffled_queue
+
+import (
+	"math/rand"
+)
+
+// A TieBreaker decides which item to pick out of a bucket of items sharing the same priority.
+type TieBreaker interface {
+	// Picks one of the size items of the priority bucket and returns its index, between 0 and size-1.
+	// Items are indexed in insertion order and size is never 0. In multiset mode an item occurring more than once
+	// has one index per occurrence. Value returns the payload of the item at an index for tie breakers that
+	// look at them; it takes logarithmic time so that picking by index alone is cheap.
+	Pick(priority, size int, value func(i int) interface{}) int
+}
+
+// Tie breakers holding state may also implement Clone to give copies of a queue, such as clones, snapshots
+// and the scratch queues of PeekN, their own state. Tie breakers without it are shared with the copies.
+type clonableTieBreaker interface {
+	Clone() TieBreaker
+}
+
+// Tie breakers holding state per priority may also implement the methods of a bucketWatcher to keep it in line
+// with the buckets of the queue: Inserted is called after an occurrence was inserted at index i of the bucket
+// of a priority, shifting the occurrences from i on, Removed after the occurrence at index i was removed
+// and Dropped once the bucket is gone, so that the state of the priority can be dropped too.
+type bucketWatcher interface {
+	Inserted(priority, i int)
+	Removed(priority, i int)
+	Dropped(priority int)
+}
+
+// Returns a copy of the tie breaker with its own state if it implements Clone, otherwise the tie breaker itself.
+func cloneTieBreaker(tb TieBreaker) TieBreaker {
+	if c, ok := tb.(clonableTieBreaker); ok {
+		return c.Clone()
+	}
+
+	return tb
+}
+
+// Picks the item that was added first.
+type fifoTieBreaker struct{}
+
+// Creates a tie breaker that picks items in the order they were added.
+func NewFIFOTieBreaker() TieBreaker {
+	return fifoTieBreaker{}
+}
+
+func (fifoTieBreaker) Pick(priority, size int, value func(i int) interface{}) int {
+	return 0
+}
+
+// Picks the item that was added last.
+type lifoTieBreaker struct{}
+
+// Creates a tie breaker that picks the most recently added item first.
+func NewLIFOTieBreaker() TieBreaker {
+	return lifoTieBreaker{}
+}
+
+func (lifoTieBreaker) Pick(priority, size int, value func(i int) interface{}) int {
+	return size - 1
+}
+
+// Picks an item uniformly at random.
+type randomTieBreaker struct {
+	rand *random
+}
+
+// Creates a tie breaker that picks an item uniformly at random.
+// If src is nil a source seeded with the current time is used.
+func NewRandomTieBreaker(src rand.Source) TieBreaker {
+	return &randomTieBreaker{rand: newRand(src)}
+}
+
+func (tb *randomTieBreaker) Clone() TieBreaker {
+	return &randomTieBreaker{rand: tb.rand.clone()}
+}
+
+func (tb *randomTieBreaker) Pick(priority, size int, value func(i int) interface{}) int {
+	return tb.rand.Intn(size)
+}
+
+// Cycles through the items of every priority bucket.
+type roundRobinTieBreaker struct {
+	next map[int]int
+}
+
+// Creates a tie breaker that cycles through the items of each priority in insertion order.
+// Adding or removing items keeps the cycle going from the item that was next.
+func NewRoundRobinTieBreaker() TieBreaker {
+	return &roundRobinTieBreaker{next: make(map[int]int)}
+}
+
+func (tb *roundRobinTieBreaker) Clone() TieBreaker {
+	next := make(map[int]int, len(tb.next))
+	for priority, i := range tb.next {
+		next[priority] = i
+	}
+
+	return &roundRobinTieBreaker{next: next}
+}
+
+func (tb *roundRobinTieBreaker) Pick(priority, size int, value func(i int) interface{}) int {
+	i := tb.next[priority] % size
+	tb.next[priority] = i + 1
+
+	return i
+}
+
+func (tb *roundRobinTieBreaker) Inserted(priority, i int) {
+	if next, ok := tb.next[priority]; ok && i < next {
+		tb.next[priority] = next + 1
+	}
+}
+
+func (tb *roundRobinTieBreaker) Removed(priority, i int) {
+	if next, ok := tb.next[priority]; ok && i < next {
+		tb.next[priority] = next - 1
+	}
+}
+
+func (tb *roundRobinTieBreaker) Dropped(priority int) {
+	delete(tb.next, priority)
+}
+
+// Picks an item at random proportionally to its weight.
+type weightedTieBreaker struct {
+	weight func(v interface{}) float64
+	rand   *random
+}
+
+// Creates a tie breaker that picks an item at random with a probability proportional to the weight of its payload.
+// Items with a non positive weight are only picked when no item has a positive weight.
+// If src is nil a source seeded with the current time is used.
+func NewWeightedTieBreaker(weight func(v interface{}) float64, src rand.Source) TieBreaker {
+	return &weightedTieBreaker{weight: weight, rand: newRand(src)}
+}
+
+func (tb *weightedTieBreaker) Clone() TieBreaker {
+	return &weightedTieBreaker{weight: tb.weight, rand: tb.rand.clone()}
+}
+
+func (tb *weightedTieBreaker) Pick(priority, size int, value func(i int) interface{}) int {
+	weights := make([]float64, size)
+	total := 0.0
+
+	for i := range weights {
+		if w := tb.weight(value(i)); w > 0 {
+			weights[i] = w
+			total += w
+		}
+	}
+
+	if total == 0 {
+		return tb.rand.Intn(size)
+	}
+
+	r := tb.rand.Float64() * total
+	for i, w := range weights {
+		if r < w {
+			return i
+		}
+		r -= w
+	}
+
+	// Rounding errors may leave us past the last positive weight
+	for i := size - 1; i >= 0; i -= 1 {
+		if weights[i] > 0 {
+			return i
+		}
+	}
+
+	return size - 1
+}
+
+// Walks a shuffled permutation of every priority bucket.
+type shuffleTieBreaker struct {
+	rand   *random
+	epochs map[int]*epoch
+}
+
+// A permutation of the indexes of a bucket shuffled lazily: a Fisher–Yates shuffle that has only drawn
+// the first next positions, with swapped holding the positions it moved.
+type epoch struct {
+	size    int
+	next    int
+	swapped map[int]int
+}
+
+// Creates a tie breaker that shuffles the items of each priority once and then walks the permutation,
+// so that repeated picks return every tied item once per epoch. A new permutation is started
+// when the previous one is exhausted or when an item of the priority is added or removed.
+// Every pick takes constant time. If src is nil a source seeded with the current time is used.
+func NewShuffleTieBreaker(src rand.Source) TieBreaker {
+	return &shuffleTieBreaker{rand: newRand(src), epochs: make(map[int]*epoch)}
+}
+
+func (tb *shuffleTieBreaker) Clone() TieBreaker {
+	epochs := make(map[int]*epoch, len(tb.epochs))
+	for priority, e := range tb.epochs {
+		swapped := make(map[int]int, len(e.swapped))
+		for position, i := range e.swapped {
+			swapped[position] = i
+		}
+
+		epochs[priority] = &epoch{size: e.size, next: e.next, swapped: swapped}
+	}
+
+	return &shuffleTieBreaker{rand: tb.rand.clone(), epochs: epochs}
+}
+
+func (tb *shuffleTieBreaker) Pick(priority, size int, value func(i int) interface{}) int {
+	e, ok := tb.epochs[priority]
+
+	// Picks made outside of a queue only tell the bucket changed by its size
+	if !ok || e.next == e.size || e.size != size {
+		e = &epoch{size: size, swapped: make(map[int]int)}
+		tb.epochs[priority] = e
+	}
+
+	return e.draw(tb.rand)
+}
+
+func (tb *shuffleTieBreaker) Inserted(priority, i int) {
+	delete(tb.epochs, priority)
+}
+
+func (tb *shuffleTieBreaker) Removed(priority, i int) {
+	delete(tb.epochs, priority)
+}
+
+func (tb *shuffleTieBreaker) Dropped(priority int) {
+	delete(tb.epochs, priority)
+}
+
+// Draws the next position of the permutation out of the ones left and returns its index.
+func (e *epoch) draw(r *random) int {
+	j := e.next + r.Intn(e.size-e.next)
+	picked, skipped := e.at(j), e.at(e.next)
+	e.swapped[j] = skipped
+	e.next += 1
+
+	return picked
+}
+
+// Returns the index at a position of the permutation.
+func (e *epoch) at(position int) int {
+	if i, ok := e.swapped[position]; ok {
+		return i
+	}
+
+	return position
+}
@@ -0,0 +1,304 @@
+package go_shuffled_queue
+
+import (
+	"math/rand"
+
+	. "gopkg.in/check.v1"
+)
+
+// Test FIFO tie breaker pops items with the same priority in insertion order.
+func (s *MySuite) TestFIFOTieBreaker(c *C) {
+	spq := NewSPQ()
+	spq.SetTieBreaker(NewFIFOTieBreaker())
+
+	spq.AddPriority("hello", 1)
+	spq.AddPriority("world", 1)
+	spq.AddPriority("welt", 1)
+
+	for _, expected := range []string{"hello", "world", "welt"} {
+		item, ok := spq.Pop()
+
+		c.Assert(ok, Equals, true)
+		c.Assert(item, Equals, expected)
+	}
+}
+
+// Test LIFO tie breaker pops the most recently added item with the same priority first.
+func (s *MySuite) TestLIFOTieBreaker(c *C) {
+	spq := NewSPQ()
+	spq.SetTieBreaker(NewLIFOTieBreaker())
+
+	spq.AddPriority("hello", 1)
+	spq.AddPriority("world", 1)
+	spq.AddPriority("welt", 1)
+
+	for _, expected := range []string{"welt", "world", "hello"} {
+		item, ok := spq.Shift()
+
+		c.Assert(ok, Equals, true)
+		c.Assert(item, Equals, expected)
+	}
+}
+
+// Test round robin tie breaker cycles through the items without mutating the queue.
+func (s *MySuite) TestRoundRobinTieBreaker(c *C) {
+	spq := NewSPQ()
+	spq.SetTieBreaker(NewRoundRobinTieBreaker())
+
+	spq.AddPriority("hello", 1)
+	spq.AddPriority("world", 1)
+	spq.AddPriority("welt", 0)
+
+	for _, expected := range []string{"hello", "world", "hello", "world"} {
+		item, _ := spq.Last()
+		c.Assert(item, Equals, expected)
+	}
+
+	c.Assert(spq.length, Equals, uint(3))
+}
+
+// Test round robin tie breaker keeps cycling from the next item when items are removed or added.
+func (s *MySuite) TestRoundRobinTieBreakerRemovals(c *C) {
+	spq := NewSPQ()
+	spq.SetTieBreaker(NewRoundRobinTieBreaker())
+
+	for _, item := range []string{"a", "b", "c", "d", "e"} {
+		spq.AddPriority(item, 1)
+	}
+
+	c.Assert(popAll(spq.Clone()), DeepEquals, []interface{}{"a", "b", "c", "d", "e"})
+
+	for _, expected := range []string{"a", "b"} {
+		item, _ := spq.Last()
+		c.Assert(item, Equals, expected)
+	}
+
+	spq.Remove("a")
+	spq.AddPriority("f", 1)
+
+	for _, expected := range []string{"c", "d", "e", "f", "b", "c"} {
+		item, _ := spq.Last()
+		c.Assert(item, Equals, expected)
+	}
+}
+
+// Test tie breakers drop the state of a priority once its items are gone.
+func (s *MySuite) TestTieBreakerStatePruned(c *C) {
+	roundRobin := NewRoundRobinTieBreaker().(*roundRobinTieBreaker)
+	shuffle := NewShuffleTieBreaker(rand.NewSource(7)).(*shuffleTieBreaker)
+
+	spq := NewSPQ()
+	spq.SetTieBreaker(roundRobin)
+	spq.SetPriorityTieBreaker(2, shuffle)
+
+	for priority := 0; priority < 3; priority += 1 {
+		spq.AddPriority("hello", priority)
+		spq.AddPriority("world", priority)
+		spq.Last()
+		spq.First()
+	}
+
+	c.Assert(roundRobin.next, HasLen, 2)
+	c.Assert(shuffle.epochs, HasLen, 1)
+
+	popAll(spq)
+	c.Assert(roundRobin.next, HasLen, 0)
+	c.Assert(shuffle.epochs, HasLen, 0)
+
+	spq.AddPriority("hello", 2)
+	spq.AddPriority("world", 2)
+	spq.Last()
+	c.Assert(shuffle.epochs, HasLen, 1)
+
+	spq.RemoveRange(0, 5)
+	c.Assert(shuffle.epochs, HasLen, 0)
+}
+
+// Test random tie breaker is reproducible with a fixed source.
+func (s *MySuite) TestRandomTieBreakerWithSeed(c *C) {
+	pops := func() []interface{} {
+		spq := NewSPQ()
+		spq.SetTieBreaker(NewRandomTieBreaker(rand.NewSource(42)))
+
+		for i := 0; i < 10; i += 1 {
+			spq.Add(i)
+		}
+
+		items := []interface{}{}
+		for item, ok := spq.Pop(); ok; item, ok = spq.Pop() {
+			items = append(items, item)
+		}
+
+		return items
+	}
+
+	c.Assert(pops(), DeepEquals, pops())
+}
+
+// Test weighted tie breaker never picks items without weight when others have some.
+func (s *MySuite) TestWeightedTieBreaker(c *C) {
+	spq := NewSPQ()
+	spq.SetTieBreaker(NewWeightedTieBreaker(func(v interface{}) float64 {
+		if v == "heavy" {
+			return 1
+		}
+		return 0
+	}, rand.NewSource(1)))
+
+	spq.AddPriority("light", 1)
+	spq.AddPriority("heavy", 1)
+	spq.AddPriority("feather", 1)
+
+	for i := 0; i < 100; i += 1 {
+		item, _ := spq.Last()
+		c.Assert(item, Equals, "heavy")
+	}
+}
+
+// Test weighted tie breaker weighs the payloads of pushed items rather than their handles.
+func (s *MySuite) TestWeightedTieBreakerPayloads(c *C) {
+	spq := NewSPQ()
+	spq.SetTieBreaker(NewWeightedTieBreaker(func(v interface{}) float64 {
+		if v == "heavy" {
+			return 1
+		}
+		return 0
+	}, rand.NewSource(1)))
+
+	spq.Push("light", 1)
+	spq.Push("heavy", 1)
+	spq.Push("feather", 1)
+
+	for i := 0; i < 20; i += 1 {
+		item, _ := spq.Last()
+		c.Assert(item, Equals, "heavy")
+	}
+}
+
+// Test a priority tie breaker overrides the queue tie breaker only for its own priority.
+func (s *MySuite) TestSetPriorityTieBreaker(c *C) {
+	spq := NewSPQ()
+	spq.SetTieBreaker(NewFIFOTieBreaker())
+	spq.SetPriorityTieBreaker(1, NewLIFOTieBreaker())
+
+	spq.AddPriority("hello", 1)
+	spq.AddPriority("world", 1)
+	spq.AddPriority("welt", 0)
+	spq.AddPriority("verden", 0)
+
+	last, _ := spq.Last()
+	first, _ := spq.First()
+
+	c.Assert(last, Equals, "world")
+	c.Assert(first, Equals, "welt")
+
+	spq.SetPriorityTieBreaker(1, nil)
+	last, _ = spq.Last()
+
+	c.Assert(last, Equals, "hello")
+}
+
+// Test Pop removes the picked item from its own bucket even if it exists in a lower one.
+func (s *MySuite) TestPopRemovesFromPickedBucket(c *C) {
+	spq := NewSPQ()
+
+	spq.AddPriority("hello", 0)
+	spq.AddPriority("hello", 1)
+
+	item, ok := spq.Pop()
+	c.Assert(item, Equals, "hello")
+	c.Assert(ok, Equals, true)
+
+	priority, found := spq.FindPriority("hello")
+	c.Assert(priority, Equals, 0)
+	c.Assert(found, Equals, true)
+	c.Assert(spq.length, Equals, uint(1))
+}
+
+// Test shuffle tie breaker returns every item with the same priority once per epoch.
+func (s *MySuite) TestShuffleTieBreakerEpochs(c *C) {
+	spq := NewSPQ()
+	spq.SetTieBreaker(NewShuffleTieBreaker(rand.NewSource(7)))
+
+	items := []string{"hello", "world", "welt", "verden", "mundo"}
+	for _, item := range items {
+		spq.AddPriority(item, 1)
+	}
+	spq.AddPriority("Atme", 0)
+
+	for epoch := 0; epoch < 3; epoch += 1 {
+		seen := map[interface{}]int{}
+
+		for i := 0; i < len(items); i += 1 {
+			item, _ := spq.Last()
+			seen[item] += 1
+		}
+
+		c.Assert(len(seen), Equals, len(items))
+		for _, item := range items {
+			c.Assert(seen[item], Equals, 1)
+		}
+	}
+}
+
+// Test shuffle tie breaker starts a new epoch when the bucket changes.
+func (s *MySuite) TestShuffleTieBreakerReshufflesOnChange(c *C) {
+	spq := NewSPQ()
+	spq.SetTieBreaker(NewShuffleTieBreaker(rand.NewSource(7)))
+
+	spq.AddPriority("hello", 1)
+	spq.AddPriority("world", 1)
+
+	spq.Last()
+	spq.AddPriority("welt", 1)
+
+	seen := map[interface{}]bool{}
+	for i := 0; i < 3; i += 1 {
+		item, _ := spq.Last()
+		seen[item] = true
+	}
+
+	c.Assert(seen, DeepEquals, map[interface{}]bool{"hello": true, "world": true, "welt": true})
+}
+
+// Test shuffle tie breaker starts a new epoch when an item is replaced by another, leaving the size unchanged.
+func (s *MySuite) TestShuffleTieBreakerReshufflesOnReplace(c *C) {
+	for seed := int64(0); seed < 20; seed += 1 {
+		spq := NewSPQ()
+		spq.SetTieBreaker(NewShuffleTieBreaker(rand.NewSource(seed)))
+
+		spq.AddPriority("hello", 1)
+		spq.AddPriority("world", 1)
+		spq.AddPriority("welt", 1)
+
+		spq.Last()
+		spq.Remove("hello")
+		spq.AddPriority("verden", 1)
+
+		seen := map[interface{}]bool{}
+		for i := 0; i < 3; i += 1 {
+			item, _ := spq.Last()
+			seen[item] = true
+		}
+
+		c.Assert(seen, DeepEquals, map[interface{}]bool{"world": true, "welt": true, "verden": true})
+	}
+}
+
+// Test shuffle tie breaker only returns items still in the queue when popping.
+func (s *MySuite) TestShuffleTieBreakerPop(c *C) {
+	spq := NewSPQ()
+	spq.SetTieBreaker(NewShuffleTieBreaker(nil))
+
+	for i := 0; i < 10; i += 1 {
+		spq.Add(i)
+	}
+
+	seen := map[interface{}]bool{}
+	for item, ok := spq.Pop(); ok; item, ok = spq.Pop() {
+		c.Assert(seen[item], Equals, false)
+		seen[item] = true
+	}
+
+	c.Assert(len(seen), Equals, 10)
+}
@@ -0,0 +1,153 @@
+package go_shuffled_queue
+
+import (
+	"fmt"
+)
+
+// Checks every structural invariant of the queue: keys are sorted and unique, every key has a non empty bucket,
+// every bucket keeps its items and their insertion order in sync, keyed items are at a single priority
+// and length matches the number of items.
+// Returns an error describing the first violation found or nil if the queue is consistent.
+func (spq *ShuffledPriorityQueue) Validate() error {
+	if len(spq.keys) != len(spq.priorities) {
+		return fmt.Errorf("shuffled queue: %d keys for %d priority buckets", len(spq.keys), len(spq.priorities))
+	}
+
+	length := uint(0)
+	keyed := map[interface{}]int{}
+
+	for i, priority := range spq.keys {
+		if i > 0 && spq.keys[i-1] >= priority {
+			return fmt.Errorf("shuffled queue: keys %v are not sorted and unique", spq.keys)
+		}
+
+		b, ok := spq.priorities[priority]
+		if !ok {
+			return fmt.Errorf("shuffled queue: key %d has no priority bucket", priority)
+		}
+
+		if err := b.validate(); err != nil {
+			return fmt.Errorf("shuffled queue: priority %d: %v", priority, err)
+		}
+
+		for _, item := range b.items() {
+			if h, ok := item.(*Handle); ok && h.queue == spq && h.priority != priority {
+				return fmt.Errorf("shuffled queue: priority %d: handle has priority %d", priority, h.priority)
+			}
+		}
+
+		for key := range b.payloads {
+			if p, ok := keyed[key]; ok {
+				return fmt.Errorf("shuffled queue: key %v is at priorities %d and %d", key, p, priority)
+			}
+			keyed[key] = priority
+		}
+
+		length += uint(b.size)
+	}
+
+	if length != spq.length {
+		return fmt.Errorf("shuffled queue: length is %d but the queue holds %d items", spq.length, length)
+	}
+
+	if spq.tieBreaker == nil {
+		return fmt.Errorf("shuffled queue: no tie breaker")
+	}
+
+	if spq.clock == nil {
+		return fmt.Errorf("shuffled queue: no clock")
+	}
+
+	return nil
+}
+
+// Checks that the bucket is not empty and that its set and insertion order hold the same items.
+func (b *bucket) validate() error {
+	if b.Cardinality() == 0 {
+		return fmt.Errorf("empty bucket")
+	}
+
+	if len(b.slots)-b.holes != b.Cardinality() || len(b.index) != b.Cardinality() {
+		return fmt.Errorf("%d items but %d ordered and %d indexed", b.Cardinality(), len(b.slots)-b.holes, len(b.index))
+	}
+
+	if len(b.weights) != len(b.slots) || len(b.tree) != len(b.slots) {
+		return fmt.Errorf("%d slots but %d weights and %d tree nodes", len(b.slots), len(b.weights), len(b.tree))
+	}
+
+	if len(b.meta) != b.Cardinality() {
+		return fmt.Errorf("%d items but %d with metadata", b.Cardinality(), len(b.meta))
+	}
+
+	keyed := 0
+
+	for slot, v := range b.slots {
+		if b.weights[slot] == 0 {
+			continue
+		}
+
+		if !b.Contains(v) {
+			return fmt.Errorf("ordered item %v is not in the bucket", v)
+		}
+
+		if i, ok := b.index[v]; !ok || i != slot {
+			return fmt.Errorf("ordered item %v is not indexed", v)
+		}
+
+		if b.weights[slot] != b.count(v) {
+			return fmt.Errorf("item %v occurs %d times but weighs %d", v, b.count(v), b.weights[slot])
+		}
+
+		if ref, ok := v.(keyRef); ok {
+			if _, ok := b.payloads[ref.key]; !ok {
+				return fmt.Errorf("keyed item %v has no payload", ref.key)
+			}
+			keyed += 1
+		}
+	}
+
+	if keyed != len(b.payloads) {
+		return fmt.Errorf("%d keyed items but %d payloads", keyed, len(b.payloads))
+	}
+
+	size := b.Cardinality()
+	for v, count := range b.counts {
+		if count < 2 || !b.Contains(v) {
+			return fmt.Errorf("item %v is counted %d times", v, count)
+		}
+		size += count - 1
+	}
+
+	if size != b.size {
+		return fmt.Errorf("size is %d but the bucket holds %d occurrences", b.size, size)
+	}
+
+	// The tree sums the weights of every slot in its range
+	for i := 1; i <= len(b.tree); i += 1 {
+		sum := 0
+		for slot := i - i&-i; slot < i; slot += 1 {
+			sum += b.weights[slot]
+		}
+
+		if b.tree[i-1] != sum {
+			return fmt.Errorf("tree node %d is %d instead of %d", i, b.tree[i-1], sum)
+		}
+	}
+
+	handles := 0
+	for _, item := range b.items() {
+		if _, ok := item.(*Handle); ok {
+			handles += 1
+		}
+	}
+
+	if handles != b.handles {
+		return fmt.Errorf("%d handles but %d counted", handles, b.handles)
+	}
+
+	if b.refs < 1 {
+		return fmt.Errorf("bucket is held by %d queues", b.refs)
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package go_shuffled_queue
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+// Test Validate accepts queues built through the API.
+func (s *MySuite) TestValidate(c *C) {
+	spq := newRangeSPQ()
+	c.Assert(NewSPQ().Validate(), IsNil)
+	c.Assert(spq.Validate(), IsNil)
+
+	snapshot := spq.Snapshot()
+	spq.Pop()
+	spq.RemoveRange(0, 3)
+
+	c.Assert(spq.Validate(), IsNil)
+	c.Assert(snapshot.Validate(), IsNil)
+}
+
+// Test Validate detects unsorted keys.
+func (s *MySuite) TestValidateUnsortedKeys(c *C) {
+	spq := newRangeSPQ()
+	spq.keys[0], spq.keys[1] = spq.keys[1], spq.keys[0]
+
+	c.Assert(spq.Validate(), ErrorMatches, "shuffled queue: keys .* are not sorted and unique")
+}
+
+// Test Validate detects empty buckets left in the priorities.
+func (s *MySuite) TestValidateEmptyBucket(c *C) {
+	spq := newRangeSPQ()
+	spq.priorities[1].Remove("welt")
+
+	c.Assert(spq.Validate(), ErrorMatches, "shuffled queue: priority 1: empty bucket")
+}
+
+// Test Validate detects keys and buckets out of sync.
+func (s *MySuite) TestValidateMissingBucket(c *C) {
+	spq := newRangeSPQ()
+	delete(spq.priorities, 5)
+
+	c.Assert(spq.Validate(), ErrorMatches, "shuffled queue: 5 keys for 4 priority buckets")
+
+	spq.priorities[4] = newBucket()
+	c.Assert(spq.Validate(), ErrorMatches, "shuffled queue: key 5 has no priority bucket")
+}
+
+// Test Validate detects a length out of sync.
+func (s *MySuite) TestValidateLength(c *C) {
+	spq := newRangeSPQ()
+	spq.length += 1
+
+	c.Assert(spq.Validate(), ErrorMatches, "shuffled queue: length is 7 but the queue holds 6 items")
+}
+
+// Test Validate detects a bucket whose set and order disagree.
+func (s *MySuite) TestValidateBucketOrder(c *C) {
+	spq := newRangeSPQ()
+	spq.priorities[3].Set.Remove("world")
+	spq.priorities[3].Set.Add("verden")
+
+	c.Assert(spq.Validate(), ErrorMatches, "shuffled queue: priority 3: ordered item world is not in the bucket")
+}
+
+// Test Validate detects a key at two priorities.
+func (s *MySuite) TestValidateKeyAtTwoPriorities(c *C) {
+	spq := newRangeSPQ()
+	spq.priorities[1].put(keyRef{"key"}, "hello")
+	spq.priorities[1].meta[keyRef{"key"}] = metadata{}
+	spq.priorities[3].put(keyRef{"key"}, "world")
+	spq.priorities[3].meta[keyRef{"key"}] = metadata{}
+	spq.length += 2
+
+	c.Assert(spq.Validate(), ErrorMatches, "shuffled queue: key key is at priorities 1 and 3")
+}